@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/buildinfo"
+	"github.com/kompotkot/tripidium/internal/config"
+	"github.com/kompotkot/tripidium/internal/service"
+	"github.com/kompotkot/tripidium/internal/types"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+
+	"golang.org/x/term"
+)
+
+// cliActor identifies administrative commands in the audit log
+const cliActor = "cli"
+
+const usage = `Usage: tripidium [config flags] <command> [arguments]
+
+Commands:
+  serve                                  Start the server (default)
+  migrate up                             Apply pending schema migrations
+  migrate down [-to VERSION]             Revert the last migration or all newer than VERSION
+  migrate status                         Show schema migrations
+  user create [-admin] USERNAME          Create user, password is read from stdin
+  user list                              List users
+  user disable USERNAME                  Forbid user to log in and use tokens
+  user enable USERNAME                   Allow disabled user again
+  user set-password USERNAME             Replace password read from stdin, revoke tokens
+  token list USERNAME                    List tokens of the user
+  token revoke TOKEN_ID | -user USERNAME Revoke token or all active tokens of the user
+  audit verify                           Verify audit log hash chain
+  config validate                        Check configuration
+  config print                           Print effective configuration, secrets are redacted
+  version                                Print build information
+  help                                   Print this help
+
+Run tripidium -h to list config flags.
+`
+
+// errUsage reports wrong command line, usage is printed
+var errUsage = errors.New("invalid command line")
+
+// cli holds state shared by administrative commands
+type cli struct {
+	cfg *types.Config
+	in  io.Reader
+	out io.Writer
+	db  db.Database
+}
+
+// runCommand executes administrative command instead of starting the server
+func runCommand(ctx context.Context, cfg *types.Config, args []string) error {
+	c := &cli{cfg: cfg, in: os.Stdin, out: os.Stdout}
+	return c.run(ctx, args)
+}
+
+// run executes command of args, the database is opened for commands using it
+func (c *cli) run(ctx context.Context, args []string) error {
+	name := strings.Join(args[:min(2, len(args))], " ")
+	switch name {
+	case "config validate":
+		if _, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args[2:], 0); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "Configuration is valid")
+		return nil
+	case "config print":
+		if _, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args[2:], 0); err != nil {
+			return err
+		}
+		fmt.Fprint(c.out, config.Dump(c.cfg))
+		return nil
+	}
+	switch args[0] {
+	case "help":
+		fmt.Fprint(c.out, usage)
+		return nil
+	case "version":
+		c.version()
+		return nil
+	}
+
+	var run func(ctx context.Context, args []string) error
+	requireSchema := true
+	switch name {
+	case "migrate up":
+		run, requireSchema = c.migrateUp, false
+	case "migrate down":
+		run, requireSchema = c.migrateDown, false
+	case "migrate status":
+		run, requireSchema = c.migrateStatus, false
+	case "user create":
+		run = c.userCreate
+	case "user list":
+		run = c.userList
+	case "user disable":
+		run = func(ctx context.Context, args []string) error { return c.userSetDisabled(ctx, args, true) }
+	case "user enable":
+		run = func(ctx context.Context, args []string) error { return c.userSetDisabled(ctx, args, false) }
+	case "user set-password":
+		run = c.userSetPassword
+	case "token list":
+		run = c.tokenList
+	case "token revoke":
+		run = c.tokenRevoke
+	case "audit verify":
+		run = c.auditVerify
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("%w: unknown command %s", errUsage, strings.Join(args, " "))
+	}
+
+	database, err := openDatabase(ctx, c.cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	c.db = database
+
+	if requireSchema {
+		current, latest, err := database.SchemaVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		if current < latest {
+			return fmt.Errorf("database schema version %d is behind %d, run tripidium migrate up", current, latest)
+		}
+	}
+
+	return run(ctx, args[2:])
+}
+
+// openDatabase connects to the configured database through the factory
+// registry, commands read their own writes, so replicas are not used
+func openDatabase(ctx context.Context, cfg types.DatabaseConfig) (db.Database, error) {
+	opts := databaseOptions(cfg)
+	opts.Psql.ReplicaURIs = nil
+
+	database, err := db.CreateDatabase(cfg.Type, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database connection: %w", err)
+	}
+	if err := database.TestConnection(ctx); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to test database connection: %w", err)
+	}
+	return database, nil
+}
+
+// parseArgs parses command flags and checks number of positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %s", errUsage, err)
+	}
+	if fs.NArg() != positional {
+		return nil, fmt.Errorf("%w: expected %d arguments, got %d", errUsage, positional, fs.NArg())
+	}
+	return fs.Args(), nil
+}
+
+func (c *cli) migrateUp(ctx context.Context, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("migrate up", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	if err := c.db.Migrate(ctx); err != nil {
+		return err
+	}
+	current, _, err := c.db.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	fmt.Fprintf(c.out, "Schema is at version %d\n", current)
+	return nil
+}
+
+func (c *cli) migrateDown(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	to := fs.Int("to", -1, "Version to revert to")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	current, _, err := c.db.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if current == 0 {
+		fmt.Fprintln(c.out, "Schema has no applied migrations")
+		return nil
+	}
+	version := *to
+	if version < 0 {
+		// Revert only the last applied migration
+		version = 0
+		for _, m := range c.db.Migrations() {
+			if m.Version < current {
+				version = m.Version
+			}
+		}
+	}
+
+	if err := c.db.Rollback(ctx, version); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Schema is at version %d\n", version)
+	return nil
+}
+
+func (c *cli) migrateStatus(ctx context.Context, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("migrate status", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+
+	current, _, err := c.db.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE")
+	for _, m := range c.db.Migrations() {
+		state := "pending"
+		if m.Version <= current {
+			state = "applied"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", m.Version, m.Name, state)
+	}
+	return tw.Flush()
+}
+
+func (c *cli) userCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	admin := fs.Bool("admin", false, "Grant administrator access")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	username := args[0]
+
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := service.CheckPassword(c.cfg.Server.PasswordPolicy, password); err != nil {
+		return fmt.Errorf("password %w", err)
+	}
+
+	// User, its administrator access and audit event are stored together
+	user, err := service.SignUp(ctx, c.db, username, password, func(tx db.Tx, user iam.User) error {
+		if *admin {
+			if _, err := tx.UpdateUser(ctx, user.Id, db.UserUpdate{IsAdmin: admin}); err != nil {
+				return fmt.Errorf("failed to grant administrator access: %w", err)
+			}
+		}
+		_, err := service.RecordAuditEvent(ctx, tx, auditEvent(iam.AuditActionUserCreate, user.Username))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	user.IsAdmin = *admin
+
+	fmt.Fprintf(c.out, "User %s created with id %s, admin: %t\n", user.Username, user.Id, user.IsAdmin)
+	return nil
+}
+
+func (c *cli) userList(ctx context.Context, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("user list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+
+	users, err := c.db.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSERNAME\tADMIN\tDISABLED\tCREATED")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%s\n", u.Id, u.Username, u.IsAdmin, u.IsDisabled, u.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (c *cli) userSetDisabled(ctx context.Context, args []string, disabled bool) error {
+	args, err := parseArgs(flag.NewFlagSet("user disable", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.db.GetUser(ctx, "", args[0])
+	if err != nil {
+		return err
+	}
+
+	action, state := iam.AuditActionUserEnable, "enabled"
+	if disabled {
+		action, state = iam.AuditActionUserDisable, "disabled"
+	}
+	err = c.db.WithTx(ctx, func(tx db.Tx) error {
+		if _, err := tx.UpdateUser(ctx, user.Id, db.UserUpdate{IsDisabled: &disabled}); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		_, err := service.RecordAuditEvent(ctx, tx, auditEvent(action, user.Username))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "User %s %s\n", user.Username, state)
+	return nil
+}
+
+func (c *cli) userSetPassword(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("user set-password", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.db.GetUser(ctx, "", args[0])
+	if err != nil {
+		return err
+	}
+
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := service.CheckPassword(c.cfg.Server.PasswordPolicy, password); err != nil {
+		return fmt.Errorf("password %w", err)
+	}
+
+	// Tokens issued with the old password are revoked together with the change
+	var revoked int
+	_, err = service.SetPassword(ctx, c.db, user.Id, password, func(tx db.Tx, user iam.User) error {
+		if _, err := service.RecordAuditEvent(ctx, tx, auditEvent(iam.AuditActionPasswordChange, user.Username)); err != nil {
+			return err
+		}
+		revoked, err = revokeActiveTokens(ctx, tx, user.Id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Password of user %s changed, %d tokens revoked\n", user.Username, revoked)
+	return nil
+}
+
+func (c *cli) tokenList(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("token list", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.db.GetUser(ctx, "", args[0])
+	if err != nil {
+		return err
+	}
+	tokens, err := c.db.ListTokens(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tISSUED\tEXPIRES\tSTATE")
+	for _, t := range tokens {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Id, t.IssuedAt.UTC().Format(time.RFC3339), t.ExpiresAt.UTC().Format(time.RFC3339), tokenState(t, now))
+	}
+	return tw.Flush()
+}
+
+func (c *cli) tokenRevoke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("token revoke", flag.ContinueOnError)
+	username := fs.String("user", "", "Revoke all active tokens of the user")
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+	args = fs.Args()
+
+	if *username == "" {
+		if len(args) != 1 {
+			return fmt.Errorf("%w: token id or -user is required", errUsage)
+		}
+		err := c.db.WithTx(ctx, func(tx db.Tx) error {
+			if err := tx.RevokeToken(ctx, args[0]); err != nil {
+				return fmt.Errorf("failed to revoke token: %w", err)
+			}
+			_, err := service.RecordAuditEvent(ctx, tx, auditEvent(iam.AuditActionTokenRevoke, args[0]))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Token %s revoked\n", args[0])
+		return nil
+	}
+
+	if len(args) != 0 {
+		return fmt.Errorf("%w: token id and -user are exclusive", errUsage)
+	}
+	user, err := c.db.GetUser(ctx, "", *username)
+	if err != nil {
+		return err
+	}
+
+	var revoked int
+	err = c.db.WithTx(ctx, func(tx db.Tx) error {
+		revoked, err = revokeActiveTokens(ctx, tx, user.Id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%d tokens of user %s revoked\n", revoked, user.Username)
+	return nil
+}
+
+func (c *cli) auditVerify(ctx context.Context, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("audit verify", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+
+	verified, err := service.VerifyAuditChain(ctx, c.db)
+	if err != nil {
+		return fmt.Errorf("%w, %d events verified before failure", err, verified)
+	}
+	fmt.Fprintf(c.out, "Audit chain is intact, %d events verified\n", verified)
+	return nil
+}
+
+func (c *cli) version() {
+	info := buildinfo.Get()
+	fmt.Fprintf(c.out, "tripidium %s\n", info.Version)
+	fmt.Fprintf(c.out, "  commit:      %s\n", info.Commit)
+	fmt.Fprintf(c.out, "  modified:    %t\n", info.Modified)
+	fmt.Fprintf(c.out, "  commit time: %s\n", info.CommitTime)
+	fmt.Fprintf(c.out, "  build time:  %s\n", info.BuildTime)
+	fmt.Fprintf(c.out, "  go:          %s\n", info.GoVersion)
+	fmt.Fprintf(c.out, "  databases:   %s\n", strings.Join(info.Databases, ", "))
+}
+
+// revokeActiveTokens revokes active tokens of the user recording an audit
+// event for each of them, returns number of revoked tokens
+func revokeActiveTokens(ctx context.Context, tx db.Tx, userId string) (int, error) {
+	tokens, err := tx.ListTokens(ctx, userId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	revoked := 0
+	now := time.Now()
+	for _, t := range tokens {
+		if tokenState(t, now) != "active" {
+			continue
+		}
+		if err := tx.RevokeToken(ctx, t.Id); err != nil {
+			return revoked, fmt.Errorf("failed to revoke token: %w", err)
+		}
+		if _, err := service.RecordAuditEvent(ctx, tx, auditEvent(iam.AuditActionTokenRevoke, t.Id)); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// auditEvent describes successful administrative command
+func auditEvent(action, target string) iam.AuditEvent {
+	return iam.AuditEvent{
+		Actor:     cliActor,
+		Action:    action,
+		Target:    target,
+		UserAgent: "tripidium-cli",
+		Result:    iam.AuditResultSuccess,
+	}
+}
+
+// tokenState describes token as active, expired or revoked
+func tokenState(t iam.Token, now time.Time) string {
+	switch {
+	case t.IsRevoked:
+		return "revoked"
+	case !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// readPassword prompts for password without echo on terminal, otherwise
+// reads the first line of input
+func (c *cli) readPassword() (string, error) {
+	if f, ok := c.in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(c.in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// exitCode returns process exit code of command error, 2 for wrong usage
+func exitCode(err error) int {
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,7 @@
+//go:build memory
+
+package main
+
+import (
+	_ "github.com/kompotkot/tripidium/pkg/db/memory" // Import to register memory factory
+)
@@ -2,39 +2,73 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/kompotkot/tripidium/internal/buildinfo"
 	"github.com/kompotkot/tripidium/internal/config"
+	"github.com/kompotkot/tripidium/internal/health"
+	"github.com/kompotkot/tripidium/internal/lifecycle"
 	"github.com/kompotkot/tripidium/internal/logger"
+	"github.com/kompotkot/tripidium/internal/metrics"
+	"github.com/kompotkot/tripidium/internal/ratelimit"
 	"github.com/kompotkot/tripidium/internal/server"
+	"github.com/kompotkot/tripidium/internal/tlsutil"
+	"github.com/kompotkot/tripidium/internal/tracing"
+	"github.com/kompotkot/tripidium/internal/types"
 	"github.com/kompotkot/tripidium/pkg/db"
 )
 
 func main() {
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, "\n"+usage)
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Printf("Failed to load config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to load config:\n%v\n", err)
 		os.Exit(1)
 	}
 
+	// Start the server unless administrative command is requested
+	if len(args) == 0 || (len(args) == 1 && args[0] == "serve") {
+		serve(cfg)
+		return
+	}
+
+	if err := runCommand(context.Background(), cfg, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// serve runs the server until shutdown signal
+func serve(cfg *types.Config) {
 	// Initialize logger
 	log := logger.New(cfg.Logger)
 	log.Info("Logger initialized")
 
+	info := buildinfo.Get()
+	log.Info("Starting tripidium",
+		"version", info.Version,
+		"commit", info.Commit,
+		"modified", info.Modified,
+		"commit_time", info.CommitTime,
+		"build_time", info.BuildTime,
+		"go_version", info.GoVersion,
+		"databases", info.Databases,
+	)
+	metrics.RegisterBuildInfo(info)
+
 	// Initialize database connection using registry
 	log.Info("Initializing database connection")
-	database, err := db.CreateDatabase(
-		cfg.Database.Type,
-		cfg.Database.URI,
-		cfg.Database.MaxConns,
-		int64(cfg.Database.ConnMaxLifetime),
-	)
+	database, err := db.CreateDatabase(cfg.Database.Type, databaseOptions(cfg.Database))
 	if err != nil {
 		log.Error("Failed to initialize database connection", "error", err)
 		os.Exit(1)
@@ -47,48 +81,177 @@ func main() {
 	}
 	log.Info("Database connection established successfully")
 
-	// Create context for graceful shutdown
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	// Apply pending schema migrations
+	if err := database.Migrate(context.Background()); err != nil {
+		log.Error("Failed to apply database migrations", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Database migrations applied successfully")
+
+	// Initialize tracing and wrap database to create a span per call
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Tracing initialized", "exporter", cfg.Tracing.Exporter)
+	database = tracing.WrapDatabase(database, cfg.Database.Type)
+
+	// Expose connection pool metrics if supported by database
+	if !metrics.RegisterDatabase(database) {
+		log.Warn("Database does not provide connection pool statistics", "type", cfg.Database.Type)
+	}
+
+	// Register readiness checks, there is no mailer to check yet
+	checker := health.NewChecker(cfg.Server.HealthCacheTTL)
+	checker.Register("database", cfg.Server.HealthCheckTimeout, health.DatabaseCheck(database))
+	checker.Register("schema", cfg.Server.HealthCheckTimeout, health.SchemaCheck(database))
+
+	// Keep rate limits in memory of this instance or share them through database
+	var rateLimitStore ratelimit.Store
+	switch cfg.Server.RateLimitStore {
+	case "database":
+		rateLimitStore = ratelimit.NewDatabaseStore(database)
+	default:
+		rateLimitStore = ratelimit.NewMemoryStore()
+	}
 
 	// Create HTTP server
-	newSrv := server.NewServer(server.Dependencies{
-		DB:  database,
-		Cfg: cfg.Server,
-		Log: log,
+	newSrv, err := server.NewServer(server.Dependencies{
+		DB:             database,
+		Cfg:            cfg.Server,
+		Log:            log,
+		Health:         checker,
+		RateLimitStore: rateLimitStore,
+		Config:         cfg,
+		LoadConfig: func() (*types.Config, error) {
+			cfg, _, err := config.Load(os.Args[1:])
+			return cfg, err
+		},
 	})
+	if err != nil {
+		log.Error("Failed to create server", "error", err)
+		os.Exit(1)
+	}
 	commonHandler := newSrv.BuildCommonHandler()
-	srv := &http.Server{
-		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Addr, cfg.Server.Port),
-		Handler: *commonHandler,
+	srv := server.NewHTTPServer(fmt.Sprintf("%s:%s", cfg.Server.Addr, cfg.Server.Port), *commonHandler, cfg.Server)
+
+	// Shutdown order: readiness, HTTP draining, background workers, tracing and database
+	lc := lifecycle.New(log, cfg.Server.ShutdownTimeout, cfg.Server.ShutdownDelay)
+	lc.OnShutdown(checker.SetShuttingDown)
+
+	if cfg.Server.TLS.Enabled() {
+		reloader, err := tlsutil.NewReloader(cfg.Server.TLS, log)
+		if err != nil {
+			log.Error("Failed to load TLS certificates", "error", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+		lc.AddServer("main", srv, func() error {
+			return srv.ListenAndServeTLS("", "")
+		})
+		lc.AddWorker("tls_reload", reloader.Watch)
+
+		// Redirect plain HTTP requests to the HTTPS listener
+		if cfg.Server.TLS.RedirectPort != "" {
+			redirectSrv := server.NewHTTPServer(
+				fmt.Sprintf("%s:%s", cfg.Server.Addr, cfg.Server.TLS.RedirectPort),
+				server.RedirectHandler(cfg.Server.Port),
+				cfg.Server,
+			)
+			lc.AddServer("redirect", redirectSrv, redirectSrv.ListenAndServe)
+		}
+	} else {
+		lc.AddServer("main", srv, srv.ListenAndServe)
 	}
 
-	// Start server in a goroutine
-	go func() {
-		log.Info("Starting HTTP server", "addr", cfg.Server.Addr, "port", cfg.Server.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Error("Server error", "error", err)
+	// Reload runtime settings on SIGHUP
+	lc.AddWorker("config_reload", func(ctx context.Context) error {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-hup:
+				if _, err := newSrv.ReloadConfig(ctx); err != nil {
+					log.Error("Failed to reload configuration", "error", err)
+				}
+			}
 		}
-	}()
+	})
 
-	// Wait for shutdown signal
-	<-ctx.Done()
-	log.Info("Received shutdown signal, starting graceful shutdown")
+	lc.AddWorker("rate_limit_cleanup", func(ctx context.Context) error {
+		return ratelimit.RunCleanup(ctx, rateLimitStore, time.Minute, log)
+	})
 
-	// Create shutdown context with timeout
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Persist in-memory data periodically
+	if snapshotter, ok := database.(db.Snapshotter); ok && cfg.Database.Memory.SnapshotInterval > 0 {
+		lc.AddWorker("database_snapshot", func(ctx context.Context) error {
+			ticker := time.NewTicker(cfg.Database.Memory.SnapshotInterval)
+			defer ticker.Stop()
 
-	// Gracefully close database connection
-	log.Info("Closing database connection")
-	database.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+					if err := snapshotter.Snapshot(); err != nil {
+						log.Error("Failed to write database snapshot", "error", err)
+					}
+				}
+			}
+		})
+	}
 
-	// Attempt graceful shutdown of HTTP server
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Error("Server shutdown error", "error", err)
-	} else {
-		log.Info("Server shutdown completed successfully")
+	// Serve metrics endpoint on admin server if configured
+	if cfg.Server.AdminPort != "" {
+		adminHandler := newSrv.BuildAdminHandler()
+		adminSrv := server.NewHTTPServer(fmt.Sprintf("%s:%s", cfg.Server.AdminAddr, cfg.Server.AdminPort), *adminHandler, cfg.Server)
+		lc.AddServer("admin", adminSrv, adminSrv.ListenAndServe)
+	}
+
+	lc.AddCloser("tracing", shutdownTracing)
+	lc.AddCloser("database", func(context.Context) error {
+		return database.Close()
+	})
+
+	if err := lc.Run(context.Background()); err != nil {
+		log.Error("Application stopped with error", "error", err)
+		os.Exit(1)
 	}
 
 	log.Info("Application shutdown complete")
 }
+
+// databaseOptions converts database configuration to options of the backends
+func databaseOptions(cfg types.DatabaseConfig) db.Options {
+	return db.Options{
+		URI: cfg.URI,
+		Pool: db.PoolOptions{
+			MaxConns:        cfg.MaxConns,
+			ConnMaxLifetime: cfg.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+		},
+		Sqlite: db.SqliteOptions{
+			WAL:         cfg.Sqlite.WAL,
+			Synchronous: cfg.Sqlite.Synchronous,
+			BusyTimeout: cfg.Sqlite.BusyTimeout,
+			CacheSize:   cfg.Sqlite.CacheSize,
+			MmapSize:    cfg.Sqlite.MmapSize,
+			ReadOnly:    cfg.Sqlite.ReadOnly,
+		},
+		Psql: db.PsqlOptions{
+			MinConns:          cfg.MinConns,
+			HealthCheckPeriod: cfg.HealthCheckPeriod,
+			ConnectTimeout:    cfg.ConnectTimeout,
+			StatementTimeout:  cfg.StatementTimeout,
+			ApplicationName:   cfg.ApplicationName,
+
+			ReplicaURIs:        cfg.ReplicaURIs,
+			ReplicaCheckPeriod: cfg.ReplicaCheckPeriod,
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// Values set at link time, e.g.
+// -ldflags "-X github.com/kompotkot/tripidium/internal/buildinfo.version=v1.0.0"
+// Empty values are taken from module and VCS information embedded by go build.
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+// Unknown is reported for values not available in the binary
+const Unknown = "unknown"
+
+// Info describes the running build
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// CommitTime is the time of the commit recorded by go build
+	CommitTime string `json:"commit_time"`
+	// BuildTime is known only if it is set at link time
+	BuildTime string `json:"build_time"`
+	// Modified is set if the binary was built from a working tree with uncommitted changes
+	Modified  bool     `json:"modified"`
+	GoVersion string   `json:"go_version"`
+	Databases []string `json:"databases"`
+}
+
+var readInfo = sync.OnceValue(func() Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				info.CommitTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	for _, v := range []*string{&info.Version, &info.Commit, &info.CommitTime, &info.BuildTime} {
+		if *v == "" {
+			*v = Unknown
+		}
+	}
+	return info
+})
+
+// Get returns information about the running build and compiled-in database backends
+func Get() Info {
+	info := readInfo()
+	info.Databases = db.GetAvailableDatabaseTypes()
+	return info
+}
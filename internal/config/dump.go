@@ -0,0 +1,62 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// Dump returns effective configuration as NAME=value lines in the format of
+// environment variables, values of secret settings are redacted
+func Dump(cfg *types.Config) string {
+	var b strings.Builder
+	for _, f := range collectFields(cfg) {
+		value := f.format()
+		if f.secret {
+			value = redactField(f, value)
+		}
+		b.WriteString(f.env + "=" + value + "\n")
+	}
+	return b.String()
+}
+
+// redactField redacts items of list settings one by one, so every URL of
+// the list keeps its host
+func redactField(f *field, value string) string {
+	list, ok := f.value.Interface().([]string)
+	if !ok {
+		return redact(value)
+	}
+
+	redacted := make([]string, 0, len(list))
+	for _, item := range list {
+		redacted = append(redacted, redact(item))
+	}
+	return strings.Join(redacted, ",")
+}
+
+// redactedValue replaces secret parts of values
+const redactedValue = "xxxxx"
+
+// redact hides secret value, URLs keep scheme, user, host, path and query
+// keys, while password and query values like sslpassword are hidden
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		if u.RawQuery != "" {
+			params := strings.Split(u.RawQuery, "&")
+			for i, param := range params {
+				if key, _, ok := strings.Cut(param, "="); ok {
+					params[i] = key + "=" + redactedValue
+				}
+			}
+			u.RawQuery = strings.Join(params, "&")
+		}
+		u.Fragment, u.RawFragment = "", ""
+		return u.Redacted()
+	}
+	return "REDACTED"
+}
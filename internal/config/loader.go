@@ -0,0 +1,404 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// field is a configuration value described by struct tags
+type field struct {
+	// env is the full variable name, e.g. SERVER_PORT
+	env string
+	// fileKey is the dotted key in configuration file, e.g. server.port
+	fileKey string
+	value   reflect.Value
+	parser  string
+	rules   string
+
+	secret     bool
+	allowEmpty bool
+}
+
+// collectFields walks configuration sections and returns their tagged fields
+func collectFields(cfg *types.Config) []*field {
+	var fields []*field
+	walkFields(reflect.ValueOf(cfg).Elem(), "", "", &fields)
+	return fields
+}
+
+func walkFields(v reflect.Value, envPrefix, filePrefix string, fields *[]*field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Nested section, its tag is a prefix of the variables
+		if f.Type.Kind() == reflect.Struct && f.Type != timeType {
+			section := strings.ToLower(strings.TrimSuffix(name, "_"))
+			walkFields(v.Field(i), envPrefix+name, filePrefix+section+".", fields)
+			continue
+		}
+
+		fd := &field{
+			env:     envPrefix + name,
+			fileKey: filePrefix + strings.ToLower(name),
+			value:   v.Field(i),
+			parser:  f.Tag.Get("parse"),
+			rules:   f.Tag.Get("validate"),
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "secret":
+				fd.secret = true
+			case "allowempty":
+				fd.allowEmpty = true
+			}
+		}
+		*fields = append(*fields, fd)
+	}
+}
+
+// flagName returns command-line flag of the field, e.g. server-port
+func (f *field) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(f.env), "_", "-")
+}
+
+// lookup returns raw value of the source with highest precedence: flag,
+// environment variable, variable with _FILE suffix naming a file with the
+// value, configuration file
+func (f *field) lookup(fileValues, flagValues map[string]string) (string, string, bool, error) {
+	if raw, ok := flagValues[f.env]; ok && (raw != "" || f.allowEmpty) {
+		return raw, "flag", true, nil
+	}
+	raw, ok, err := f.lookupEnv()
+	if err != nil {
+		return "", "", false, err
+	}
+	if ok && (raw != "" || f.allowEmpty) {
+		return raw, "env", true, nil
+	}
+	if raw, ok := fileValues[f.env]; ok && (raw != "" || f.allowEmpty) {
+		return raw, "file", true, nil
+	}
+	return "", "", false, nil
+}
+
+// lookupEnv reads the variable or the file named by its _FILE variant
+func (f *field) lookupEnv() (string, bool, error) {
+	raw, ok := os.LookupEnv(f.env)
+	path, fileOk := os.LookupEnv(f.env + "_FILE")
+	if !fileOk || path == "" {
+		return raw, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("only one of %s and %s_FILE may be set", f.env, f.env)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s_FILE: %w", f.env, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// set parses raw value into the field
+func (f *field) set(raw string) error {
+	if f.parser != "" {
+		parsed, err := parsers[f.parser].parse(raw)
+		if err != nil {
+			return err
+		}
+		f.value.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+
+	switch f.value.Interface().(type) {
+	case time.Duration:
+		sec, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("must be a number of seconds")
+		}
+		f.value.SetInt(int64(time.Duration(sec) * time.Second))
+		return nil
+	case []string:
+		f.value.Set(reflect.ValueOf(splitList(raw)))
+		return nil
+	case map[string]bool:
+		f.value.Set(reflect.ValueOf(parseList(raw)))
+		return nil
+	}
+
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		f.value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		f.value.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		f.value.SetFloat(n)
+	default:
+		panic("unsupported config field type " + f.value.Type().String())
+	}
+	return nil
+}
+
+// format returns the field value in the form accepted by set
+func (f *field) format() string {
+	if f.parser != "" {
+		return parsers[f.parser].format(f.value.Interface())
+	}
+
+	switch v := f.value.Interface().(type) {
+	case time.Duration:
+		return strconv.Itoa(int(v / time.Second))
+	case []string:
+		return strings.Join(v, ",")
+	case map[string]bool:
+		return formatSet(v)
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// validate checks validate tag rules: required, min=N and max=N limit
+// numbers, durations in seconds, oneof=a b allows listed values, port
+// requires a port number, rules except required skip empty values
+func (f *field) validate() error {
+	if f.rules == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(f.rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name != "required" && f.value.Kind() == reflect.String && f.value.String() == "" {
+			continue
+		}
+
+		switch name {
+		case "required":
+			if f.value.IsZero() {
+				return errors.New("is required")
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic("invalid config validate rule " + rule)
+			}
+			var value float64
+			switch v := f.value.Interface().(type) {
+			case time.Duration:
+				value = v.Seconds()
+			case int:
+				value = float64(v)
+			case int64:
+				value = float64(v)
+			case float64:
+				value = v
+			default:
+				panic("config validate rule " + rule + " is not supported for " + f.value.Type().String())
+			}
+			if name == "min" && value < limit {
+				return fmt.Errorf("%s must be at least %s", f.format(), arg)
+			}
+			if name == "max" && value > limit {
+				return fmt.Errorf("%s must be at most %s", f.format(), arg)
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !slices.Contains(allowed, f.value.String()) {
+				return fmt.Errorf("%s must be one of %s", f.value.String(), strings.Join(allowed, ", "))
+			}
+		case "port":
+			port, err := strconv.Atoi(f.value.String())
+			if err != nil || port < 0 || port > 65535 {
+				return fmt.Errorf("%s must be a port number", f.value.String())
+			}
+		default:
+			panic("unknown config validate rule " + rule)
+		}
+	}
+	return nil
+}
+
+// parser converts values of fields with parse tag
+type parser struct {
+	parse  func(string) (any, error)
+	format func(any) string
+}
+
+var parsers = map[string]parser{
+	"origins": {
+		parse:  func(s string) (any, error) { return parseCORSOrigins(s) },
+		format: func(v any) string { return formatSet(v.(map[string]bool)) },
+	},
+	"prefixes": {
+		parse: func(s string) (any, error) { return parseTrustedProxies(s) },
+		format: func(v any) string {
+			var list []string
+			for _, prefix := range v.([]netip.Prefix) {
+				list = append(list, prefix.String())
+			}
+			return strings.Join(list, ",")
+		},
+	},
+	"rate_limits": {
+		parse: func(s string) (any, error) { return parseRateLimits(s) },
+		format: func(v any) string {
+			var list []string
+			for _, l := range v.([]types.RateLimit) {
+				list = append(list, fmt.Sprintf("%s:%s=%d/%s", l.Route, l.Scope, l.Requests, l.Period))
+			}
+			return strings.Join(list, ",")
+		},
+	},
+	"tls_version": {
+		parse: func(s string) (any, error) { return parseTLSVersion(s) },
+		format: func(v any) string {
+			for _, version := range []string{"1.2", "1.3"} {
+				if id, _ := parseTLSVersion(version); id == v.(uint16) {
+					return version
+				}
+			}
+			return ""
+		},
+	},
+	"cipher_suites": {
+		parse: func(s string) (any, error) { return parseCipherSuites(s) },
+		format: func(v any) string {
+			var list []string
+			for _, id := range v.([]uint16) {
+				list = append(list, tls.CipherSuiteName(id))
+			}
+			return strings.Join(list, ",")
+		},
+	},
+}
+
+// readFile reads YAML or TOML configuration file, chosen by extension, into
+// raw values by variable names, unknown keys are rejected
+func readFile(path string, fields []*field) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	doc := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %s, must be .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	flat := map[string]any{}
+	flatten(doc, "", flat)
+
+	envByKey := map[string]string{}
+	for _, f := range fields {
+		envByKey[f.fileKey] = f.env
+	}
+
+	values := map[string]string{}
+	var errs []error
+	for _, key := range sortedKeys(flat) {
+		env, ok := envByKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown key %s in config file %s", key, path))
+			continue
+		}
+		raw, err := fileValue(flat[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid key %s in config file %s: %w", key, path, err))
+			continue
+		}
+		values[env] = raw
+	}
+	return values, errors.Join(errs...)
+}
+
+// flatten converts nested tables into dotted keys
+func flatten(doc map[string]any, prefix string, flat map[string]any) {
+	for key, value := range doc {
+		if table, ok := value.(map[string]any); ok {
+			flatten(table, prefix+key+".", flat)
+			continue
+		}
+		flat[prefix+key] = value
+	}
+}
+
+// fileValue converts scalar or list of scalars to raw value, lists are joined by comma
+func fileValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case map[string]any:
+		return "", errors.New("must not be a table")
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				return "", errors.New("must be a list of scalars")
+			}
+			list = append(list, fmt.Sprint(item))
+		}
+		return strings.Join(list, ","), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatSet joins sorted set members by comma
+func formatSet(set map[string]bool) string {
+	return strings.Join(sortedKeys(set), ",")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
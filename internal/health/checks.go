@@ -0,0 +1,27 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// DatabaseCheck pings the database
+func DatabaseCheck(database db.Database) CheckFunc {
+	return database.TestConnection
+}
+
+// SchemaCheck verifies that all migrations known to the database implementation are applied
+func SchemaCheck(database db.Database) CheckFunc {
+	return func(ctx context.Context) error {
+		current, latest, err := database.SchemaVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		if current != latest {
+			return fmt.Errorf("schema version %d does not match expected %d", current, latest)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check and report statuses
+const (
+	StatusOk           = "ok"
+	StatusFailed       = "failed"
+	StatusShuttingDown = "shutting_down"
+)
+
+// CheckFunc returns error if dependency is not healthy
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+}
+
+// CheckResult represents outcome of a single check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report represents readiness state with per-check details
+type Report struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checked_at"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// Ready reports whether all checks passed and the process is not shutting down
+func (r Report) Ready() bool {
+	return r.Status == StatusOk
+}
+
+// Checker runs registered readiness checks and caches their results
+type Checker struct {
+	mu           sync.Mutex
+	checks       []check
+	cacheTTL     time.Duration
+	last         Report
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a new checker, results are reused for cacheTTL
+func NewChecker(cacheTTL time.Duration) *Checker {
+	return &Checker{cacheTTL: cacheTTL}
+}
+
+// Register adds named check limited by timeout
+func (c *Checker) Register(name string, timeout time.Duration, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+	c.last = Report{}
+}
+
+// SetShuttingDown marks the process as not ready to accept new traffic
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs all checks concurrently or returns cached report
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown, CheckedAt: time.Now(), Checks: map[string]CheckResult{}}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < c.cacheTTL {
+		return c.last
+	}
+
+	report := Report{
+		Status:    StatusOk,
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]CheckResult, len(c.checks)),
+	}
+
+	// Report is cached and shared by callers, so a canceled request must not
+	// fail the checks, each of them is limited by its own timeout instead
+	checkCtx := context.WithoutCancel(ctx)
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(checkCtx, chk)
+		}()
+	}
+	wg.Wait()
+
+	for i, chk := range c.checks {
+		report.Checks[chk.name] = results[i]
+		if results[i].Status != StatusOk {
+			report.Status = StatusFailed
+		}
+	}
+
+	c.last = report
+	return report
+}
+
+// runCheck executes check within its timeout
+func runCheck(ctx context.Context, chk check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, chk.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- chk.fn(ctx)
+	}()
+
+	// Do not wait for checks ignoring context cancellation
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOk, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
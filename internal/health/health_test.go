@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckIgnoresCanceledRequest(t *testing.T) {
+	c := NewChecker(time.Hour)
+	c.Register("slow", time.Second, func(ctx context.Context) error {
+		select {
+		case <-time.After(10 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := c.Check(ctx); !report.Ready() {
+		t.Fatalf("status = %s, want %s: %v", report.Status, StatusOk, report.Checks)
+	}
+
+	// The cached report is served to following callers
+	if report := c.Check(context.Background()); !report.Ready() {
+		t.Fatalf("cached status = %s, want %s", report.Status, StatusOk)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	c := NewChecker(0)
+	c.Register("stuck", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Check(context.Background())
+	if report.Status != StatusFailed {
+		t.Fatalf("status = %s, want %s", report.Status, StatusFailed)
+	}
+	if got := report.Checks["stuck"].Error; got != context.DeadlineExceeded.Error() {
+		t.Errorf("error = %q, want %q", got, context.DeadlineExceeded.Error())
+	}
+}
@@ -0,0 +1,200 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrForcedShutdown = errors.New("forced shutdown by second signal")
+
+type server struct {
+	name  string
+	srv   *http.Server
+	serve func() error
+}
+
+type worker struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// Manager starts HTTP servers and background workers and stops them in order:
+// readiness hooks, HTTP draining, workers and finally resources like database
+type Manager struct {
+	log             *slog.Logger
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+
+	hooks   []func()
+	servers []server
+	workers []worker
+	closers []closer
+}
+
+// New creates lifecycle manager, shutdownDelay keeps serving after readiness
+// is dropped to let load balancers notice, shutdownTimeout limits draining
+func New(log *slog.Logger, shutdownTimeout, shutdownDelay time.Duration) *Manager {
+	return &Manager{
+		log:             log,
+		shutdownTimeout: shutdownTimeout,
+		shutdownDelay:   shutdownDelay,
+	}
+}
+
+// OnShutdown registers hook called first when shutdown begins
+func (m *Manager) OnShutdown(fn func()) {
+	m.hooks = append(m.hooks, fn)
+}
+
+// AddServer registers HTTP server, serve is a blocking call like srv.ListenAndServe
+func (m *Manager) AddServer(name string, srv *http.Server, serve func() error) {
+	m.servers = append(m.servers, server{name: name, srv: srv, serve: serve})
+}
+
+// AddWorker registers background worker, its context is cancelled after HTTP draining
+func (m *Manager) AddWorker(name string, run func(ctx context.Context) error) {
+	m.workers = append(m.workers, worker{name: name, run: run})
+}
+
+// AddCloser registers resource closed at the end of shutdown in registration order
+func (m *Manager) AddCloser(name string, close func(ctx context.Context) error) {
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Run blocks until a termination signal, ctx cancellation or a fatal
+// server or worker failure, then performs ordered shutdown
+func (m *Manager) Run(ctx context.Context) error {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	errCh := make(chan error, len(m.servers)+len(m.workers))
+
+	for _, s := range m.servers {
+		go func() {
+			m.log.Info("Starting HTTP server", "name", s.name, "addr", s.srv.Addr)
+			if err := s.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("%s server failed: %w", s.name, err)
+			}
+		}()
+	}
+
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+
+	var workersWg sync.WaitGroup
+	for _, w := range m.workers {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			m.log.Info("Starting background worker", "name", w.name)
+			if err := w.run(workersCtx); err != nil && !errors.Is(err, context.Canceled) {
+				errCh <- fmt.Errorf("%s worker failed: %w", w.name, err)
+			}
+		}()
+	}
+
+	var runErr error
+	select {
+	case sig := <-sigCh:
+		m.log.Info("Received shutdown signal, starting graceful shutdown", "signal", sig.String())
+	case <-ctx.Done():
+		m.log.Info("Context cancelled, starting graceful shutdown")
+	case runErr = <-errCh:
+		m.log.Error("Fatal error, starting shutdown", "error", runErr)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancelShutdown()
+
+	// Second signal skips draining
+	forced := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigCh:
+			m.log.Warn("Received second signal, stopping immediately", "signal", sig.String())
+			close(forced)
+			cancelShutdown()
+		case <-shutdownCtx.Done():
+		}
+	}()
+
+	// Stop readiness first, so no new traffic is routed to this instance
+	for _, hook := range m.hooks {
+		hook()
+	}
+
+	if m.shutdownDelay > 0 && runErr == nil {
+		m.log.Info("Waiting before draining connections", "delay", m.shutdownDelay)
+		select {
+		case <-time.After(m.shutdownDelay):
+		case <-shutdownCtx.Done():
+		}
+	}
+
+	m.drainServers(shutdownCtx)
+
+	cancelWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workersWg.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+		m.log.Info("Background workers stopped")
+	case <-shutdownCtx.Done():
+		m.log.Error("Background workers did not stop in time")
+	}
+
+	// Resources are closed even on forced shutdown with a fresh deadline
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancelClose()
+	for _, c := range m.closers {
+		m.log.Info("Closing resource", "name", c.name)
+		if err := c.close(closeCtx); err != nil {
+			m.log.Error("Failed to close resource", "name", c.name, "error", err)
+		}
+	}
+
+	select {
+	case <-forced:
+		if runErr == nil {
+			runErr = ErrForcedShutdown
+		}
+	default:
+	}
+
+	return runErr
+}
+
+// drainServers gracefully shuts down all servers, closing them if deadline is exceeded
+func (m *Manager) drainServers(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range m.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.srv.Shutdown(ctx); err != nil {
+				m.log.Error("Server shutdown error, closing connections", "name", s.name, "error", err)
+				s.srv.Close()
+				return
+			}
+			m.log.Info("Server shutdown completed successfully", "name", s.name)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,212 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recorder collects names of shutdown steps in order of calls
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) record(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.steps)
+}
+
+// addClosers registers closers recording their names
+func addClosers(m *Manager, rec *recorder, names ...string) {
+	for _, name := range names {
+		m.AddCloser(name, func(ctx context.Context) error {
+			rec.record("close " + name)
+			return nil
+		})
+	}
+}
+
+// runAsync starts Run and returns channel receiving its result
+func runAsync(ctx context.Context, m *Manager) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	return done
+}
+
+// wait returns result of Run failing the test if it does not finish in time
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+		return nil
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	rec := &recorder{}
+	m := New(slog.New(slog.DiscardHandler), 5*time.Second, delay)
+
+	hookCalled := make(chan struct{})
+	m.OnShutdown(func() {
+		rec.record("hook")
+		close(hookCalled)
+	})
+
+	// Request in flight outlives the delay, so draining has to wait for it
+	started := make(chan struct{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-hookCalled
+		time.Sleep(delay + 50*time.Millisecond)
+		rec.record("request")
+	})}
+	m.AddServer("api", srv, func() error { return srv.Serve(ln) })
+
+	m.AddWorker("cleanup", func(ctx context.Context) error {
+		<-ctx.Done()
+		rec.record("worker")
+		return ctx.Err()
+	})
+	addClosers(m, rec, "database", "tracing")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runAsync(ctx, m)
+
+	requestDone := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestDone <- err
+	}()
+	<-started
+
+	start := time.Now()
+	cancel()
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("shutdown took %v, want at least the delay %v", elapsed, delay)
+	}
+	if err := <-requestDone; err != nil {
+		t.Errorf("request in flight failed: %v", err)
+	}
+
+	want := []string{"hook", "request", "worker", "close database", "close tracing"}
+	if got := rec.get(); !slices.Equal(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestRunFatalError(t *testing.T) {
+	rec := &recorder{}
+	m := New(slog.New(slog.DiscardHandler), 5*time.Second, time.Minute)
+	m.OnShutdown(func() { rec.record("hook") })
+
+	errWorker := errors.New("queue is gone")
+	m.AddWorker("consumer", func(ctx context.Context) error { return errWorker })
+	m.AddWorker("cleanup", func(ctx context.Context) error {
+		<-ctx.Done()
+		rec.record("worker")
+		return nil
+	})
+	addClosers(m, rec, "database")
+
+	// Fatal error does not wait for the delay of a minute
+	err := wait(t, runAsync(context.Background(), m))
+	if !errors.Is(err, errWorker) {
+		t.Errorf("Run = %v, want %v", err, errWorker)
+	}
+
+	want := []string{"hook", "worker", "close database"}
+	if got := rec.get(); !slices.Equal(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestRunWorkerTimeout(t *testing.T) {
+	rec := &recorder{}
+	m := New(slog.New(slog.DiscardHandler), 50*time.Millisecond, 0)
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	m.AddWorker("stuck", func(ctx context.Context) error {
+		<-stuck
+		return nil
+	})
+	addClosers(m, rec, "database")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := wait(t, runAsync(ctx, m)); err != nil {
+		t.Errorf("Run = %v, want nil", err)
+	}
+
+	// Resources are closed although the worker did not stop
+	if got, want := rec.get(), []string{"close database"}; !slices.Equal(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestRunSecondSignal(t *testing.T) {
+	rec := &recorder{}
+	m := New(slog.New(slog.DiscardHandler), time.Minute, time.Minute)
+
+	// Shutdown is started by ctx, signal arrives while Run handles signals
+	m.OnShutdown(func() {
+		rec.record("hook")
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Errorf("FindProcess: %v", err)
+			return
+		}
+		if err := p.Signal(syscall.SIGTERM); err != nil {
+			t.Errorf("Signal: %v", err)
+		}
+	})
+	stuck := make(chan struct{})
+	defer close(stuck)
+	m.AddWorker("stuck", func(ctx context.Context) error {
+		<-stuck
+		return nil
+	})
+	addClosers(m, rec, "database")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := wait(t, runAsync(ctx, m))
+	if !errors.Is(err, ErrForcedShutdown) {
+		t.Errorf("Run = %v, want %v", err, ErrForcedShutdown)
+	}
+
+	if got, want := rec.get(), []string{"hook", "close database"}; !slices.Equal(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+}
@@ -7,25 +7,16 @@ import (
 	"github.com/kompotkot/tripidium/internal/types"
 )
 
+// level of loggers created by New, it may be changed at runtime with SetLevel
+var level = new(slog.LevelVar)
+
 // Initialize main logger
 func New(lc types.LoggerConfig) *slog.Logger {
 	var logHandler slog.Handler
 
-	// Parse the log level
-	var logLevel slog.Level
-	switch lc.Level {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
-
+	SetLevel(lc.Level)
 	logOpts := &slog.HandlerOptions{
-		Level: logLevel,
+		Level: level,
 	}
 
 	// Parse the log format
@@ -35,5 +26,19 @@ func New(lc types.LoggerConfig) *slog.Logger {
 		logHandler = slog.NewTextHandler(os.Stdout, logOpts)
 	}
 
-	return slog.New(logHandler)
+	return slog.New(&traceHandler{Handler: logHandler})
+}
+
+// SetLevel changes level of all loggers created by New, unknown levels mean info
+func SetLevel(name string) {
+	switch name {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "warn":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	default:
+		level.Set(slog.LevelInfo)
+	}
 }
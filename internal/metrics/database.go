@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"github.com/kompotkot/tripidium/pkg/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dbMaxConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "max_conns"),
+		"Maximum number of database connections in the pool.", nil, nil,
+	)
+	dbTotalConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "total_conns"),
+		"Number of open database connections.", nil, nil,
+	)
+	dbIdleConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "idle_conns"),
+		"Number of idle database connections.", nil, nil,
+	)
+	dbInUseConnsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "in_use_conns"),
+		"Number of database connections currently in use.", nil, nil,
+	)
+	dbWaitCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "wait_total"),
+		"Total number of connection acquires which had to wait.", nil, nil,
+	)
+	dbWaitDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "wait_seconds_total"),
+		"Total time spent waiting for a connection.", nil, nil,
+	)
+)
+
+// dbPoolCollector reads pool statistics on every scrape
+type dbPoolCollector struct {
+	provider db.StatsProvider
+}
+
+func (c *dbPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxConnsDesc
+	ch <- dbTotalConnsDesc
+	ch <- dbIdleConnsDesc
+	ch <- dbInUseConnsDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+}
+
+func (c *dbPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.provider.Stats()
+
+	ch <- prometheus.MustNewConstMetric(dbMaxConnsDesc, prometheus.GaugeValue, float64(stats.MaxConns))
+	ch <- prometheus.MustNewConstMetric(dbTotalConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(dbIdleConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(dbInUseConnsDesc, prometheus.GaugeValue, float64(stats.InUseConns))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kompotkot/tripidium/internal/buildinfo"
+	"github.com/kompotkot/tripidium/pkg/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tripidium"
+
+// Auth metric labels
+const (
+	AuthActionSignUp = "signup"
+	AuthActionLogin  = "login"
+
+	AuthResultSuccess = "success"
+	AuthResultFailure = "failure"
+)
+
+// Registry holds all application collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests by route, method and status code.",
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"route", "method"},
+	)
+
+	AuthAttemptsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_attempts_total",
+			Help:      "Total number of authentication attempts by action and result.",
+		},
+		[]string{"action", "result"},
+	)
+
+	PasswordHashDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hash_duration_seconds",
+			Help:      "Argon2 password hashing duration.",
+			Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+	)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		AuthAttemptsTotal,
+		PasswordHashDuration,
+	)
+}
+
+// Handler returns HTTP handler serving metrics in Prometheus text exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDatabase exposes connection pool gauges if database supports statistics
+func RegisterDatabase(database db.Database) bool {
+	provider, ok := database.(db.StatsProvider)
+	if !ok {
+		return false
+	}
+
+	Registry.MustRegister(&dbPoolCollector{provider: provider})
+	return true
+}
+
+// RegisterBuildInfo exposes build metadata as labels of a constant gauge
+func RegisterBuildInfo(info buildinfo.Info) {
+	buildInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "build_info",
+			Help:      "Build information of the running binary, the value is always 1.",
+		},
+		[]string{"version", "commit", "commit_time", "build_time", "modified", "go_version", "databases"},
+	)
+	buildInfo.WithLabelValues(
+		info.Version, info.Commit, info.CommitTime, info.BuildTime, strconv.FormatBool(info.Modified),
+		info.GoVersion, strings.Join(info.Databases, ","),
+	).Set(1)
+
+	Registry.MustRegister(buildInfo)
+}
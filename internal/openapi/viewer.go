@@ -0,0 +1,20 @@
+package openapi
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed viewer.html
+var viewerHTML string
+
+var viewerTemplate = template.Must(template.New("viewer").Parse(viewerHTML))
+
+// ViewerHandler serves embedded Swagger UI page rendering the document from specURL
+func ViewerHandler(specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		viewerTemplate.Execute(w, struct{ SpecURL string }{SpecURL: specURL})
+	})
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// DatabaseStore keeps arrival times in the database, so limits hold across replicas
+type DatabaseStore struct {
+	db db.Database
+}
+
+// NewDatabaseStore creates store backed by the database
+func NewDatabaseStore(database db.Database) *DatabaseStore {
+	return &DatabaseStore{db: database}
+}
+
+func (s *DatabaseStore) Update(ctx context.Context, key string, update func(tat time.Time) time.Time) error {
+	return s.db.UpdateRateLimit(ctx, key, update)
+}
+
+func (s *DatabaseStore) Cleanup(ctx context.Context, before time.Time) error {
+	_, err := s.db.DeleteRateLimits(ctx, before)
+	return err
+}
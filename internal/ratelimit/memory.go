@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps arrival times in process memory, limits are not shared
+// between replicas
+type MemoryStore struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+// NewMemoryStore creates empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tats: map[string]time.Time{}}
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, update func(tat time.Time) time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tats[key] = update(s.tats[key])
+	return nil
+}
+
+func (s *MemoryStore) Cleanup(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, tat := range s.tats {
+		if tat.Before(before) {
+			delete(s.tats, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Limit allows Requests per Period, all of them may arrive at once
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result is a rate limit decision for a single request
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests allowed immediately after this one
+	Remaining int
+	// RetryAfter is the time until the next request is allowed, zero if allowed
+	RetryAfter time.Duration
+	// Reset is the time until the limit is fully restored
+	Reset time.Duration
+}
+
+// emissionInterval returns time between evenly spaced requests
+func (l Limit) emissionInterval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Apply implements generic cell rate algorithm, which is an equivalent of
+// token bucket with capacity Requests refilled every Period. tat is the
+// theoretical arrival time stored for the key, zero for unknown keys.
+func (l Limit) Apply(tat, now time.Time) (time.Time, Result) {
+	interval := l.emissionInterval()
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-l.Period)
+	if now.Before(allowAt) {
+		return tat, Result{
+			Allowed:    false,
+			Limit:      l.Requests,
+			Remaining:  0,
+			RetryAfter: allowAt.Sub(now),
+			Reset:      tat.Sub(now),
+		}
+	}
+
+	return newTAT, Result{
+		Allowed:   true,
+		Limit:     l.Requests,
+		Remaining: int(now.Sub(allowAt) / interval),
+		Reset:     newTAT.Sub(now),
+	}
+}
+
+// Store keeps theoretical arrival times of keys
+type Store interface {
+	// Update atomically replaces arrival time of the key with the value
+	// returned by update, zero time is passed for unknown keys
+	Update(ctx context.Context, key string, update func(tat time.Time) time.Time) error
+
+	// Cleanup removes keys with arrival time before the time
+	Cleanup(ctx context.Context, before time.Time) error
+}
+
+// Take applies the limit to the key and records the request if it is allowed
+func Take(ctx context.Context, store Store, key string, limit Limit, now time.Time) (Result, error) {
+	var res Result
+	err := store.Update(ctx, key, func(tat time.Time) time.Time {
+		var newTAT time.Time
+		newTAT, res = limit.Apply(tat, now)
+		return newTAT
+	})
+	return res, err
+}
+
+// Refund returns the request recorded by Take to the key, e.g. when another
+// limit of the same request denied it
+func Refund(ctx context.Context, store Store, key string, limit Limit) error {
+	return store.Update(ctx, key, func(tat time.Time) time.Time {
+		if tat.IsZero() {
+			return tat
+		}
+		return tat.Add(-limit.emissionInterval())
+	})
+}
+
+// RunCleanup periodically removes expired keys until ctx is cancelled, it is
+// a lifecycle worker
+func RunCleanup(ctx context.Context, store Store, interval time.Duration, log *slog.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if err := store.Cleanup(ctx, now); err != nil {
+				log.Error("Failed to clean up rate limits", "error", err)
+			}
+		}
+	}
+}
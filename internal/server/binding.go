@@ -0,0 +1,384 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeForm = "application/x-www-form-urlencoded"
+)
+
+// bindError is a request binding failure reported to the client
+type bindError struct {
+	status  int
+	code    string
+	message string
+	fields  map[string]string
+}
+
+func (e *bindError) Error() string {
+	return e.message
+}
+
+// validator is implemented by request types with checks beyond validate tags
+type validator interface {
+	Validate() error
+}
+
+// bindRequest decodes request body into dst according to Content-Type and
+// validates it, on failure the error response is written and false returned.
+//
+// Fields are named by their json tag in both JSON and form bodies, unknown
+// fields are rejected, body size is limited by the route. Supported validate tag rules are required, min=N and
+// max=N, which limit length of strings and value of numbers.
+func (h *handlers) bindRequest(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := decodeBody(r, dst)
+	if err == nil {
+		err = validateRequest(dst)
+	}
+	return h.handleBindError(w, r, err)
+}
+
+// bindQuery decodes URL query parameters into dst and validates it, unknown
+// parameters are ignored, fields of dst keep their values if parameter is absent
+func (h *handlers) bindQuery(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := decodeValues(r.URL.Query(), dst, false)
+	if err == nil {
+		err = validateRequest(dst)
+	}
+	return h.handleBindError(w, r, err)
+}
+
+// handleBindError writes error response of binding failure
+func (h *handlers) handleBindError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	var bindErr *bindError
+	if !errors.As(err, &bindErr) {
+		h.logger(r).ErrorContext(r.Context(), "internal.server.binding.bindRequest", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+		return false
+	}
+
+	writeErrorResponse(w, bindErr.status, ErrorResponse{
+		Error:   bindErr.code,
+		Message: bindErr.message,
+		Fields:  bindErr.fields,
+	})
+	return false
+}
+
+// decodeBody decodes JSON or form encoded body into dst
+func decodeBody(r *http.Request, dst any) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return &bindError{
+			status:  http.StatusUnsupportedMediaType,
+			code:    ErrorCodeUnsupportedMediaType,
+			message: "Content-Type header is required, supported are " + mediaTypeJSON + " and " + mediaTypeForm,
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &bindError{
+			status:  http.StatusUnsupportedMediaType,
+			code:    ErrorCodeUnsupportedMediaType,
+			message: "Malformed Content-Type header",
+		}
+	}
+
+	switch mediaType {
+	case mediaTypeJSON:
+		return decodeJSON(r.Body, dst)
+	case mediaTypeForm:
+		if err := r.ParseForm(); err != nil {
+			if tooLargeErr := asTooLarge(err); tooLargeErr != nil {
+				return tooLargeErr
+			}
+			return &bindError{status: http.StatusBadRequest, code: ErrorCodeBadRequest, message: "Failed to parse the form"}
+		}
+		return decodeValues(r.PostForm, dst, true)
+	default:
+		return &bindError{
+			status:  http.StatusUnsupportedMediaType,
+			code:    ErrorCodeUnsupportedMediaType,
+			message: "Unsupported Content-Type " + mediaType + ", supported are " + mediaTypeJSON + " and " + mediaTypeForm,
+		}
+	}
+}
+
+// decodeJSON decodes exactly one JSON object without unknown fields
+func decodeJSON(body io.Reader, dst any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		if tooLargeErr := asTooLarge(err); tooLargeErr != nil {
+			return tooLargeErr
+		}
+
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			return &bindError{status: http.StatusBadRequest, code: ErrorCodeBadRequest, message: "Request body must not be empty"}
+		case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+			return &bindError{status: http.StatusBadRequest, code: ErrorCodeBadRequest, message: "Request body contains malformed JSON"}
+		case errors.As(err, &typeErr) && typeErr.Field == "":
+			return &bindError{status: http.StatusBadRequest, code: ErrorCodeBadRequest, message: "Request body must be a JSON object"}
+		case errors.As(err, &typeErr):
+			return &bindError{
+				status:  http.StatusBadRequest,
+				code:    ErrorCodeValidation,
+				message: "Request body contains invalid field type",
+				fields:  map[string]string{typeErr.Field: "must be " + typeErr.Type.String()},
+			}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return &bindError{
+				status:  http.StatusBadRequest,
+				code:    ErrorCodeValidation,
+				message: "Request body contains unknown field",
+				fields:  map[string]string{field: "unknown field"},
+			}
+		default:
+			return &bindError{status: http.StatusBadRequest, code: ErrorCodeBadRequest, message: "Failed to decode request body"}
+		}
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if tooLargeErr := asTooLarge(err); tooLargeErr != nil {
+			return tooLargeErr
+		}
+		return &bindError{status: http.StatusBadRequest, code: ErrorCodeBadRequest, message: "Request body must contain a single JSON object"}
+	}
+
+	return nil
+}
+
+// asTooLarge converts body size limit error
+func asTooLarge(err error) *bindError {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return &bindError{
+		status:  http.StatusRequestEntityTooLarge,
+		code:    ErrorCodeRequestTooLarge,
+		message: fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit),
+	}
+}
+
+// decodeValues sets struct fields from url values, strict mode rejects
+// unknown and repeated keys
+func decodeValues(values url.Values, dst any, strict bool) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binding destination must be a pointer to struct, got %T", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	fields := map[string]string{}
+	known := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := fieldName(f)
+		if name == "" {
+			continue
+		}
+		known[name] = true
+
+		vals, ok := values[name]
+		if !ok {
+			continue
+		}
+		if strict && len(vals) > 1 {
+			fields[name] = "must not be repeated"
+			continue
+		}
+		if err := setField(v.Field(i), vals[0]); err != nil {
+			fields[name] = err.Error()
+		}
+	}
+
+	if strict {
+		for name := range values {
+			if !known[name] {
+				fields[name] = "unknown field"
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return &bindError{
+			status:  http.StatusBadRequest,
+			code:    ErrorCodeValidation,
+			message: "Request contains invalid fields",
+			fields:  fields,
+		}
+	}
+	return nil
+}
+
+// setField parses raw value into the field of supported kind
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return errors.New("must be RFC3339 time")
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive integer")
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// validateRequest checks validate tags and Validate method of dst
+func validateRequest(dst any) error {
+	v := reflect.Indirect(reflect.ValueOf(dst))
+	t := v.Type()
+
+	fields := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := fieldName(f)
+		rules := f.Tag.Get("validate")
+		if name == "" || rules == "" {
+			continue
+		}
+		if msg := checkRules(v.Field(i), rules); msg != "" {
+			fields[name] = msg
+		}
+	}
+
+	if len(fields) == 0 {
+		if val, ok := dst.(validator); ok {
+			if err := val.Validate(); err != nil {
+				return &bindError{status: http.StatusBadRequest, code: ErrorCodeValidation, message: err.Error()}
+			}
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &bindError{
+		status:  http.StatusBadRequest,
+		code:    ErrorCodeValidation,
+		message: "Invalid fields: " + strings.Join(names, ", "),
+		fields:  fields,
+	}
+}
+
+// checkRules returns violation message of the first failed rule or empty string
+func checkRules(field reflect.Value, rules string) string {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "required":
+			if field.IsZero() {
+				return "is required"
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic("invalid validate rule " + rule)
+			}
+
+			var value float64
+			unit := ""
+			switch field.Kind() {
+			case reflect.String:
+				value = float64(len([]rune(field.String())))
+				unit = " characters"
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				value = float64(field.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				value = float64(field.Uint())
+			case reflect.Float32, reflect.Float64:
+				value = field.Float()
+			default:
+				panic("validate rule " + rule + " is not supported for " + field.Type().String())
+			}
+
+			if name == "min" && value < limit {
+				return "must be at least " + arg + unit
+			}
+			if name == "max" && value > limit {
+				return "must be at most " + arg + unit
+			}
+		default:
+			panic("unknown validate rule " + rule)
+		}
+	}
+	return ""
+}
+
+// fieldName returns name of the field in requests following json tag or empty
+// string if the field is not bound
+func fieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
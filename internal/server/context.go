@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// RequestIdHeader carries request identifier between clients, proxies and the server
+const RequestIdHeader = "X-Request-ID"
+
+// maxRequestIdLen limits accepted client provided request identifiers
+const maxRequestIdLen = 128
+
+type contextKey string
+
+const (
+	userContextKey        contextKey = "user"
+	tokenIdContextKey     contextKey = "token_id"
+	requestInfoContextKey contextKey = "request_info"
+	routeNameContextKey   contextKey = "route_name"
+)
+
+// requestInfo holds request-scoped data shared between middlewares and handlers
+type requestInfo struct {
+	id     string
+	ip     string
+	log    *slog.Logger
+	userId string
+	// rateLimits are taken by the request so far, they are refunded if a
+	// limit applied later denies it
+	rateLimits []takenRateLimit
+	// rateLimit is the strictest result reported in headers so far
+	rateLimit *appliedRateLimit
+}
+
+// userFromContext returns authenticated user set by authMiddleware
+func userFromContext(ctx context.Context) (iam.User, bool) {
+	user, ok := ctx.Value(userContextKey).(iam.User)
+	return user, ok
+}
+
+// tokenIdFromContext returns bearer token of the request set by authMiddleware
+func tokenIdFromContext(ctx context.Context) string {
+	tokenId, _ := ctx.Value(tokenIdContextKey).(string)
+	return tokenId
+}
+
+// routeNameFromContext returns name of the matched route set by routeHandler
+func routeNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(routeNameContextKey).(string)
+	return name
+}
+
+// requestInfoFromContext returns request data set by requestMiddleware
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
+
+// requestIdFromContext returns identifier of the current request
+func requestIdFromContext(ctx context.Context) string {
+	if info := requestInfoFromContext(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// loggerFromContext returns request-scoped logger or the fallback one
+func loggerFromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if info := requestInfoFromContext(ctx); info != nil && info.log != nil {
+		return info.log
+	}
+	return fallback
+}
+
+// logger returns request-scoped logger
+func (s *Server) logger(r *http.Request) *slog.Logger {
+	return loggerFromContext(r.Context(), s.deps.Log)
+}
+
+// newRequestId generates random request identifier
+func newRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isValidRequestId accepts only short identifiers of safe characters to keep logs clean
+func isValidRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientIP returns the request origin address, X-Forwarded-For is honoured
+// only when the request came through configured trusted proxies
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !s.isTrustedProxy(remote) {
+		return host
+	}
+
+	// Walk from the closest hop and return the first address which is not a trusted proxy
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !s.isTrustedProxy(hop) {
+			return hop.String()
+		}
+		host = hop.String()
+	}
+
+	return host
+}
+
+// isTrustedProxy checks address against configured trusted proxies
+func (s *Server) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.deps.Cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
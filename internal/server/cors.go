@@ -0,0 +1,287 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// CORSPolicy describes which cross-origin requests browsers may perform
+type CORSPolicy struct {
+	// Origins are exact origins like https://app.example.com, wildcard
+	// subdomain patterns like https://*.example.com or * for any origin
+	Origins []string
+	// Methods allowed for cross-origin requests
+	Methods []string
+	// AllowedHeaders may be sent by cross-origin requests
+	AllowedHeaders []string
+	// ExposedHeaders are readable by cross-origin scripts
+	ExposedHeaders []string
+	// AllowCredentials permits cookies, authorization headers and client
+	// certificates, it is never applied to any origin
+	AllowCredentials bool
+	// MaxAge is how long browsers cache preflight responses
+	MaxAge time.Duration
+}
+
+// PublicCORSPolicy allows read-only access without credentials from any origin
+var PublicCORSPolicy = &CORSPolicy{
+	Origins:        []string{"*"},
+	Methods:        []string{http.MethodGet, http.MethodHead},
+	AllowedHeaders: []string{RequestIdHeader},
+	ExposedHeaders: []string{RequestIdHeader},
+	MaxAge:         24 * time.Hour,
+}
+
+// originPattern matches origins of subdomains, e.g. https://*.example.com
+type originPattern struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+// corsPolicy is a CORSPolicy prepared for request matching
+type corsPolicy struct {
+	anyOrigin      bool
+	origins        map[string]bool
+	patterns       []originPattern
+	methods        []string
+	allowedHeaders map[string]bool
+	credentials    bool
+
+	allowMethods  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// compile prepares the policy, invalid origins are skipped as they are
+// validated by configuration loading
+func (p *CORSPolicy) compile() *corsPolicy {
+	c := &corsPolicy{
+		origins:        map[string]bool{},
+		allowedHeaders: map[string]bool{},
+		credentials:    p.AllowCredentials,
+		allowMethods:   strings.Join(p.Methods, ", "),
+		exposeHeaders:  strings.Join(p.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range p.Origins {
+		if origin == "*" {
+			c.anyOrigin = true
+			c.credentials = false
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if host, ok := strings.CutPrefix(u.Hostname(), "*."); ok {
+			c.patterns = append(c.patterns, originPattern{
+				scheme: strings.ToLower(u.Scheme),
+				suffix: "." + strings.ToLower(host),
+				port:   u.Port(),
+			})
+			continue
+		}
+		c.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	for _, method := range p.Methods {
+		c.methods = append(c.methods, strings.ToUpper(strings.TrimSpace(method)))
+	}
+	for _, header := range p.AllowedHeaders {
+		c.allowedHeaders[strings.ToLower(strings.TrimSpace(header))] = true
+	}
+	if p.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(p.MaxAge / time.Second))
+	}
+
+	return c
+}
+
+// allowOrigin reports whether the origin is allowed
+func (c *corsPolicy) allowOrigin(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if c.origins[origin] {
+		return true
+	}
+	if len(c.patterns) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, p := range c.patterns {
+		// Suffix must be preceded by at least one label
+		if u.Scheme == p.scheme && u.Port() == p.port &&
+			strings.HasSuffix(u.Hostname(), p.suffix) && len(u.Hostname()) > len(p.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether all headers of Access-Control-Request-Headers are allowed
+func (c *corsPolicy) allowHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !c.allowedHeaders[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOriginHeaders writes headers shared by preflight and actual responses
+func (c *corsPolicy) setOriginHeaders(h http.Header, origin string) {
+	if c.anyOrigin && !c.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsPolicies holds policies of routes by ServeMux pattern, the default
+// policy is taken from runtime settings as its whitelist may be reloaded
+type corsPolicies struct {
+	runtime *runtime
+	routes  map[string]*corsPolicy
+}
+
+// newCORSPolicies compiles route policies
+func (s *Server) newCORSPolicies(routes []Route) *corsPolicies {
+	policies := &corsPolicies{
+		runtime: s.runtime,
+		routes:  map[string]*corsPolicy{},
+	}
+	for _, rt := range routes {
+		if rt.CORS == nil {
+			continue
+		}
+		policy := rt.CORS.compile()
+		policies.routes[rt.Pattern()] = policy
+		if rt.Versioned && rt.LegacyAlias {
+			policies.routes[rt.Method+" "+rt.Path] = policy
+		}
+	}
+	return policies
+}
+
+// defaultCORSPolicy returns policy of routes without own one from configuration
+func defaultCORSPolicy(cfg types.ServerConfig) *CORSPolicy {
+	origins := make([]string, 0, len(cfg.CORSWhitelist))
+	for origin := range cfg.CORSWhitelist {
+		origins = append(origins, origin)
+	}
+	slices.Sort(origins)
+
+	var methods []string
+	for _, method := range strings.Split(cfg.CORSAllowedDefaultMethods, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			methods = append(methods, method)
+		}
+	}
+
+	return &CORSPolicy{
+		Origins:          origins,
+		Methods:          methods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+}
+
+// policy returns policy of the route matching request method and path
+func (p *corsPolicies) policy(mux *http.ServeMux, r *http.Request) (*corsPolicy, bool) {
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return nil, false
+	}
+	if policy, ok := p.routes[pattern]; ok {
+		return policy, true
+	}
+	return p.runtime.load().corsDefault, true
+}
+
+// CORS middleware answers preflight requests and adds CORS headers to
+// responses of allowed origins according to the matched route policy
+func (s *Server) corsMiddleware(mux *http.ServeMux, policies *corsPolicies, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if origin != "" && r.Method == http.MethodOptions && requestMethod != "" {
+			s.preflight(w, r, mux, policies, origin, requestMethod)
+			return
+		}
+
+		// Responses differ by origin, caches must not share them, responses
+		// of requests without origin are cached too unless the policy is wildcard
+		policy, ok := policies.policy(mux, r)
+		if origin != "" || (ok && !policy.anyOrigin) {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if origin != "" && ok && policy.allowOrigin(origin) {
+			policy.setOriginHeaders(w.Header(), origin)
+			if policy.exposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight answers CORS preflight request for the route of requested method
+func (s *Server) preflight(w http.ResponseWriter, r *http.Request, mux *http.ServeMux, policies *corsPolicies, origin, requestMethod string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	// Match the route which will serve the actual request
+	actual := r.Clone(r.Context())
+	actual.Method = requestMethod
+	policy, ok := policies.policy(mux, actual)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrorCodeNotFound, "Not found")
+		return
+	}
+
+	if !policy.allowOrigin(origin) {
+		writeError(w, http.StatusForbidden, ErrorCodeCORSRejected, "Origin is not allowed")
+		return
+	}
+	if !slices.Contains(policy.methods, strings.ToUpper(requestMethod)) {
+		writeError(w, http.StatusForbidden, ErrorCodeCORSRejected, "Method is not allowed")
+		return
+	}
+	requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+	if !policy.allowHeaders(requestHeaders) {
+		writeError(w, http.StatusForbidden, ErrorCodeCORSRejected, "Headers are not allowed")
+		return
+	}
+
+	policy.setOriginHeaders(h, origin)
+	h.Set("Access-Control-Allow-Methods", policy.allowMethods)
+	if requestHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", requestHeaders)
+	}
+	if policy.maxAge != "" {
+		h.Set("Access-Control-Max-Age", policy.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCORSVaryOrigin(t *testing.T) {
+	_, handler := newSpecServer(t, newSpecDB(t), func(deps *Dependencies) {
+		deps.Cfg.CORSWhitelist = map[string]bool{"https://app.example.com": true}
+	})
+	_, wildcard := newSpecServer(t, newSpecDB(t), func(deps *Dependencies) {
+		deps.Cfg.CORSWhitelist = map[string]bool{"*": true}
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		origin  string
+		vary    bool
+	}{
+		{"whitelist with origin", handler, http.MethodGet, "/v1/user", "https://app.example.com", true},
+		{"whitelist other origin", handler, http.MethodGet, "/v1/user", "https://evil.example.com", true},
+		{"whitelist without origin", handler, http.MethodGet, "/v1/user", "", true},
+		{"whitelist alias without origin", handler, http.MethodPost, "/login", "", true},
+		{"public policy without origin", handler, http.MethodGet, "/ping", "", false},
+		{"wildcard without origin", wildcard, http.MethodGet, "/v1/user", "", false},
+		{"unmatched route without origin", handler, http.MethodGet, "/missing", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, r)
+
+			vary := slices.Contains(w.Header().Values("Vary"), "Origin")
+			if vary != tt.vary {
+				t.Errorf("Vary: Origin = %v, want %v, got Vary %q", vary, tt.vary, w.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSAllowOrigin(t *testing.T) {
+	policy := (&CORSPolicy{Origins: []string{
+		"https://app.example.com/",
+		"https://*.example.com",
+		"http://*.local.test:8080",
+		"not a url",
+	}}).compile()
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://App.Example.COM", true},
+		{"https://api.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://.example.com", false},
+		{"http://api.example.com", false},
+		{"https://api.example.com:8443", false},
+		{"https://api.example.com.evil.com", false},
+		{"https://evilexample.com", false},
+		{"https://example.com.evil.com", false},
+		{"http://dev.local.test:8080", true},
+		{"http://dev.local.test", false},
+		{"http://dev.local.test:8081", false},
+		{"not a url", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := policy.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	anyOrigin := (&CORSPolicy{Origins: []string{"*"}}).compile()
+	if !anyOrigin.allowOrigin("https://anything.test") {
+		t.Error("wildcard policy rejected origin")
+	}
+	empty := (&CORSPolicy{}).compile()
+	if empty.allowOrigin("https://app.example.com") {
+		t.Error("policy without origins allowed origin")
+	}
+}
+
+func TestCORSCompile(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      CORSPolicy
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{"credentials of exact origin", CORSPolicy{Origins: []string{"https://app.example.com"}, AllowCredentials: true}, "https://app.example.com", "https://app.example.com", "true"},
+		{"credentials of pattern", CORSPolicy{Origins: []string{"https://*.example.com"}, AllowCredentials: true}, "https://api.example.com", "https://api.example.com", "true"},
+		{"no credentials", CORSPolicy{Origins: []string{"https://app.example.com"}}, "https://app.example.com", "https://app.example.com", ""},
+		{"credentials dropped for wildcard", CORSPolicy{Origins: []string{"*"}, AllowCredentials: true}, "https://app.example.com", "*", ""},
+		{"credentials dropped for wildcard among origins", CORSPolicy{Origins: []string{"https://app.example.com", "*"}, AllowCredentials: true}, "https://app.example.com", "*", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			tt.policy.compile().setOriginHeaders(h, tt.origin)
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.credentials)
+			}
+		})
+	}
+
+	policy := (&CORSPolicy{
+		Methods:        []string{"get", " POST "},
+		ExposedHeaders: []string{"X-Request-ID", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}).compile()
+	if !slices.Equal(policy.methods, []string{http.MethodGet, http.MethodPost}) {
+		t.Errorf("methods = %v, want [GET POST]", policy.methods)
+	}
+	if policy.exposeHeaders != "X-Request-ID, Retry-After" {
+		t.Errorf("exposeHeaders = %q", policy.exposeHeaders)
+	}
+	if policy.maxAge != "600" {
+		t.Errorf("maxAge = %q, want 600", policy.maxAge)
+	}
+}
+
+func TestCORSAllowHeaders(t *testing.T) {
+	policy := (&CORSPolicy{AllowedHeaders: []string{"Content-Type", " Authorization ", "X-Request-ID"}}).compile()
+
+	tests := []struct {
+		requested string
+		want      bool
+	}{
+		{"", true},
+		{"content-type", true},
+		{"Content-Type, AUTHORIZATION,x-request-id", true},
+		{" , ", true},
+		{"X-Custom", false},
+		{"Content-Type, X-Custom", false},
+	}
+	for _, tt := range tests {
+		if got := policy.allowHeaders(tt.requested); got != tt.want {
+			t.Errorf("allowHeaders(%q) = %v, want %v", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	_, handler := newSpecServer(t, newSpecDB(t), func(deps *Dependencies) {
+		deps.Cfg.CORSWhitelist = map[string]bool{"https://*.example.com": true}
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		origin  string
+		method  string
+		headers string
+		status  int
+	}{
+		{"allowed", "/v1/user", "https://app.example.com", http.MethodGet, "Authorization, X-Request-ID", http.StatusNoContent},
+		{"allowed without headers", "/v1/user", "https://app.example.com", http.MethodGet, "", http.StatusNoContent},
+		{"bare domain", "/v1/user", "https://example.com", http.MethodGet, "", http.StatusForbidden},
+		{"other scheme", "/v1/user", "http://app.example.com", http.MethodGet, "", http.StatusForbidden},
+		{"suffix attack", "/v1/user", "https://app.example.com.evil.com", http.MethodGet, "", http.StatusForbidden},
+		{"method not allowed", "/v1/login", "https://app.example.com", http.MethodPost, "", http.StatusForbidden},
+		{"header not allowed", "/v1/user", "https://app.example.com", http.MethodGet, "X-Custom", http.StatusForbidden},
+		{"unknown route", "/missing", "https://app.example.com", http.MethodGet, "", http.StatusNotFound},
+		{"unknown method of route", "/v1/user", "https://app.example.com", http.MethodDelete, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body: %s", w.Code, tt.status, w.Body)
+			}
+			h := w.Header()
+			if tt.status == http.StatusForbidden {
+				var resp ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decode error response: %v", err)
+				}
+				if resp.Error != ErrorCodeCORSRejected {
+					t.Errorf("error = %s, want %s", resp.Error, ErrorCodeCORSRejected)
+				}
+			}
+			if tt.status != http.StatusNoContent {
+				if got := h.Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Access-Control-Allow-Origin = %q on rejected preflight", got)
+				}
+				return
+			}
+
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+			}
+			if got := h.Get("Access-Control-Allow-Methods"); got != "GET, OPTIONS" {
+				t.Errorf("Access-Control-Allow-Methods = %q, want GET, OPTIONS", got)
+			}
+			if got := h.Get("Access-Control-Allow-Headers"); got != tt.headers {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.headers)
+			}
+			if got := h.Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Codes of API error responses, errors of the database layer use db.ErrorCode
+const (
+	ErrorCodeBadRequest           = "bad_request"
+	ErrorCodeValidation           = "validation_failed"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeRequestTooLarge      = "request_too_large"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeInvalidCredentials   = "invalid_credentials"
+	ErrorCodeForbidden            = "forbidden"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeCORSRejected         = "cors_rejected"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeInvalidConfig        = "invalid_config"
+	ErrorCodeInternal             = "internal_error"
+)
+
+// ErrorResponse is the envelope of all API error responses
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// Fields maps invalid request fields to violation messages
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// writeError responds with JSON error envelope
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorResponse(w, status, ErrorResponse{Error: code, Message: message})
+}
+
+// writeErrorResponse responds with prepared JSON error envelope
+func writeErrorResponse(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,28 +2,81 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/kompotkot/tripidium/internal/buildinfo"
+	"github.com/kompotkot/tripidium/internal/metrics"
 	"github.com/kompotkot/tripidium/internal/service"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
 )
 
+const defaultAuditEventsLimit = 100
+
 // Extensible handlers interface
 type Handlers interface {
 	Ping(w http.ResponseWriter, r *http.Request)
+	Healthz(w http.ResponseWriter, r *http.Request)
+	Readyz(w http.ResponseWriter, r *http.Request)
+	Version(w http.ResponseWriter, r *http.Request)
 	SignUp(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
 	User(w http.ResponseWriter, r *http.Request)
+	AuditEvents(w http.ResponseWriter, r *http.Request)
+	ReloadConfig(w http.ResponseWriter, r *http.Request)
 }
 
 // handlers holds handlers with dependencies
 type handlers struct {
-	deps Dependencies
+	deps    Dependencies
+	runtime *runtime
+}
+
+// Handlers returns handlers sharing dependencies and runtime settings of the
+// server, so they follow configuration reloads
+func (s *Server) Handlers() Handlers {
+	return s.newHandlers()
+}
+
+func (s *Server) newHandlers() *handlers {
+	return &handlers{deps: s.deps, runtime: s.runtime}
+}
+
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+type SignUpRequest struct {
+	Username string `json:"username" validate:"required,max=64"`
+	Password string `json:"password" validate:"required,max=256"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" validate:"required,max=64"`
+	Password string `json:"password" validate:"required,max=256"`
+}
+
+// AuditEventsQuery holds query parameters of audit events listing
+type AuditEventsQuery struct {
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Result  string    `json:"result"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+	AfterId int64     `json:"after_id" validate:"min=0"`
+	Limit   int       `json:"limit" validate:"min=1,max=1000"`
 }
 
-// NewHandlers creates a new handlers instance with dependencies
-func NewHandlers(deps Dependencies) Handlers {
-	return &handlers{deps: deps}
+type TokenResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
 }
 
 type UserResponse struct {
@@ -33,38 +86,104 @@ type UserResponse struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// logger returns request-scoped logger
+func (h *handlers) logger(r *http.Request) *slog.Logger {
+	return loggerFromContext(r.Context(), h.deps.Log)
+}
+
+// audit records security-relevant event, failures are logged and do not affect the response
+func (h *handlers) audit(r *http.Request, actor, action, target, result string) {
+	event := h.auditEvent(r, actor, action, target, result)
+	_, err := service.RecordAuditEvent(r.Context(), h.deps.DB, event)
+	if err != nil {
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.audit", "action", action, "error", err)
+	}
+}
+
+// auditEvent describes action of the request for the audit log
+func (h *handlers) auditEvent(r *http.Request, actor, action, target, result string) iam.AuditEvent {
+	event := iam.AuditEvent{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		UserAgent: r.UserAgent(),
+		Result:    result,
+	}
+	if info := requestInfoFromContext(r.Context()); info != nil {
+		event.IP = info.ip
+		event.RequestId = info.id
+	}
+	return event
+}
+
 // Ping handles the ping-pong endpoint
 func (h *handlers) Ping(w http.ResponseWriter, r *http.Request) {
-	h.deps.Log.Info("internal.server.handlers.Ping", "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("pong"))
 }
 
+// Healthz reports that the process is alive
+func (h *handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatusResponse{Status: "ok"})
+}
+
+// Version returns build information of the running binary
+func (h *handlers) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
+
+// Readyz reports whether the server dependencies are healthy and it can accept traffic
+func (h *handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.deps.Health.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Ready() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
 // SignUp handles new user registrations
 func (h *handlers) SignUp(w http.ResponseWriter, r *http.Request) {
-	h.deps.Log.Info("internal.server.handlers.SignUp", "method", r.Method, "path", r.URL.Path)
-
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	var req SignUpRequest
+	if !h.bindRequest(w, r, &req) {
 		return
 	}
-
-	if err := r.ParseForm(); err != nil {
-		h.deps.Log.Error("internal.server.handlers.SignUp", "error", err)
-		http.Error(w, "Failed to parse the form", http.StatusBadGateway)
+	if err := service.CheckPassword(h.runtime.load().passwordPolicy, req.Password); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, ErrorResponse{
+			Error:   ErrorCodeValidation,
+			Message: "Password does not satisfy the policy",
+			Fields:  map[string]string{"password": err.Error()},
+		})
 		return
 	}
 
-	username := r.FormValue("username")
-	password := r.FormValue("password")
-
-	user, err := service.SignUp(r.Context(), h.deps.DB, username, password)
+	// User is stored only together with its audit event
+	user, err := service.SignUp(r.Context(), h.deps.DB, req.Username, req.Password, func(tx db.Tx, user iam.User) error {
+		event := h.auditEvent(r, user.Id, iam.AuditActionSignUp, user.Username, iam.AuditResultSuccess)
+		_, err := service.RecordAuditEvent(r.Context(), tx, event)
+		return err
+	})
 	if err != nil {
-		h.deps.Log.Error("internal.server.handlers.SignUp", "error", err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.SignUp", "error", err)
+		h.audit(r, "", iam.AuditActionSignUp, req.Username, iam.AuditResultFailure)
+		metrics.AuthAttemptsTotal.WithLabelValues(metrics.AuthActionSignUp, metrics.AuthResultFailure).Inc()
+		if errors.Is(err, db.ErrUserAlreadyExists) {
+			writeError(w, http.StatusConflict, db.ErrorCode(err), "User already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Failed to create user")
 		return
 	}
 
+	metrics.AuthAttemptsTotal.WithLabelValues(metrics.AuthActionSignUp, metrics.AuthResultSuccess).Inc()
+
 	w.Header().Set("Content-Type", "application/json")
 
 	response := UserResponse{
@@ -76,32 +195,108 @@ func (h *handlers) SignUp(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (h *handlers) User(w http.ResponseWriter, r *http.Request) {
-	h.deps.Log.Info("internal.server.handlers.User", "method", r.Method, "path", r.URL.Path)
+// Login handles credentials verification and issues a new token
+func (h *handlers) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if !h.bindRequest(w, r, &req) {
+		return
+	}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	user, token, err := service.Login(r.Context(), h.deps.DB, req.Username, req.Password, h.deps.Cfg.TokenTTL)
+	if err != nil {
+		h.audit(r, user.Id, iam.AuditActionLoginFailed, req.Username, iam.AuditResultFailure)
+		metrics.AuthAttemptsTotal.WithLabelValues(metrics.AuthActionLogin, metrics.AuthResultFailure).Inc()
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			writeError(w, http.StatusUnauthorized, ErrorCodeInvalidCredentials, "Invalid username or password")
+			return
+		}
+		if errors.Is(err, service.ErrUserDisabled) {
+			writeError(w, http.StatusForbidden, ErrorCodeForbidden, "User is disabled")
+			return
+		}
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.Login", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	tokenId := strings.TrimPrefix(authHeader, "Bearer ")
+	h.audit(r, user.Id, iam.AuditActionLogin, user.Username, iam.AuditResultSuccess)
+	metrics.AuthAttemptsTotal.WithLabelValues(metrics.AuthActionLogin, metrics.AuthResultSuccess).Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	response := TokenResponse{
+		AccessToken: token.Id,
+		TokenType:   "Bearer",
+		ExpiresAt:   token.ExpiresAt,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Refresh rotates the request token
+func (h *handlers) Refresh(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Token is required")
+		return
+	}
+	tokenId := tokenIdFromContext(r.Context())
 	if tokenId == "" {
-		http.Error(w, "Token is required", http.StatusUnauthorized)
+		writeError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Request is not authenticated by token")
 		return
 	}
 
-	token, err := h.deps.DB.GetToken(r.Context(), tokenId)
+	token, err := service.RefreshToken(r.Context(), h.deps.DB, user, tokenId, h.deps.Cfg.TokenTTL)
 	if err != nil {
-		h.deps.Log.Error("internal.server.handlers.Logout", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.Refresh", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
 		return
 	}
 
-	user, err := h.deps.DB.GetUser(r.Context(), token.UserId, "")
-	if err != nil {
-		h.deps.Log.Error("internal.server.handlers.User", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	h.audit(r, user.Id, iam.AuditActionTokenRefresh, user.Id, iam.AuditResultSuccess)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	response := TokenResponse{
+		AccessToken: token.Id,
+		TokenType:   "Bearer",
+		ExpiresAt:   token.ExpiresAt,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Logout revokes the request token
+func (h *handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Token is required")
+		return
+	}
+
+	tokenId := tokenIdFromContext(r.Context())
+	if tokenId == "" {
+		writeError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Request is not authenticated by token")
+		return
+	}
+
+	if err := service.Logout(r.Context(), h.deps.DB, tokenId); err != nil {
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.Logout", "error", err)
+		h.audit(r, user.Id, iam.AuditActionTokenRevoke, user.Id, iam.AuditResultFailure)
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+		return
+	}
+
+	h.audit(r, user.Id, iam.AuditActionTokenRevoke, user.Id, iam.AuditResultSuccess)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// User returns the authenticated user
+func (h *handlers) User(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Token is required")
 		return
 	}
 
@@ -115,3 +310,52 @@ func (h *handlers) User(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// AuditEvents handles administrative audit log queries
+func (h *handlers) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := AuditEventsQuery{Limit: defaultAuditEventsLimit}
+	if !h.bindQuery(w, r, &query) {
+		return
+	}
+
+	filter := db.AuditEventFilter{
+		Actor:   query.Actor,
+		Action:  query.Action,
+		Target:  query.Target,
+		Result:  query.Result,
+		Since:   query.Since,
+		Until:   query.Until,
+		AfterId: query.AfterId,
+		Limit:   query.Limit,
+	}
+
+	events, err := h.deps.DB.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.AuditEvents", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// ReloadConfig applies reloadable settings from configuration sources
+func (h *handlers) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	// Action, target and result are set by the reload
+	result, err := h.runtime.reload(r.Context(), h.auditEvent(r, user.Id, "", "", ""))
+	if errors.Is(err, ErrReloadDisabled) {
+		writeError(w, http.StatusNotFound, ErrorCodeNotFound, "Configuration reload is not enabled")
+		return
+	}
+	if err != nil {
+		h.logger(r).ErrorContext(r.Context(), "internal.server.handlers.ReloadConfig", "error", err)
+		writeError(w, http.StatusUnprocessableEntity, ErrorCodeInvalidConfig, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -1,7 +1,24 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/metrics"
+	"github.com/kompotkot/tripidium/internal/service"
+	"github.com/kompotkot/tripidium/internal/tracing"
+	"github.com/kompotkot/tripidium/pkg/db"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Handle panic errors to prevent server shutdown
@@ -9,8 +26,8 @@ func (s *Server) panicMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				s.deps.Log.Info("internal.server.middlewares.panicMiddleware", "error", err)
-				http.Error(w, "Internal server error", 500)
+				s.logger(r).ErrorContext(r.Context(), "internal.server.middlewares.panicMiddleware", "error", err)
+				writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
 			}
 		}()
 		// There will be a defer with panic handler in each next function
@@ -18,35 +35,211 @@ func (s *Server) panicMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// CORS middleware
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+// Set default security headers, routes override them with Route.SecurityHeaders
+func (s *Server) securityHeadersMiddleware(next http.Handler) http.Handler {
+	hsts := ""
+	if s.deps.Cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(s.deps.Cfg.HSTSMaxAge/time.Second)) + "; includeSubDomains"
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var allowedOrigin string
-		if s.deps.Cfg.CORSWhitelist["*"] {
-			allowedOrigin = "*"
-		} else {
-			origin := r.Header.Get("Origin")
-			if _, ok := s.deps.Cfg.CORSWhitelist[origin]; ok {
-				allowedOrigin = origin
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if s.deps.Cfg.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", s.deps.Cfg.ContentSecurityPolicy)
+		}
+		if s.deps.Cfg.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", s.deps.Cfg.ReferrerPolicy)
+		}
+		if s.deps.Cfg.FrameOptions != "" {
+			h.Set("X-Frame-Options", s.deps.Cfg.FrameOptions)
+		}
+		// Browsers ignore HSTS received over plain HTTP
+		if hsts != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Authenticate request by bearer token or service client certificate and put
+// the user into request context
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		tokenId := strings.TrimPrefix(authHeader, "Bearer ")
+
+		// Services authenticate with client certificates instead of tokens
+		if tokenId == "" {
+			if user, ok := s.serviceUser(r); ok {
+				if info := requestInfoFromContext(r.Context()); info != nil {
+					info.userId = user.Id
+				}
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+				if !s.rateLimit(w, r, routeNameFromContext(r.Context()), RateLimitScopeUser) {
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
 			}
 		}
 
-		if allowedOrigin != "" {
-			allowHeaders := "Content-Type"
-			if allowedOrigin != "*" {
-				allowHeaders += ", Authorization"
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
-				// Don't allow credentials for wildcard
+		if tokenId == "" {
+			writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Token is required")
+			return
+		}
+
+		user, err := service.Authenticate(r.Context(), s.deps.DB, tokenId)
+		if err != nil {
+			if errors.Is(err, db.ErrTokenNotFound) || errors.Is(err, db.ErrUserNotFound) ||
+				errors.Is(err, service.ErrTokenRevoked) || errors.Is(err, service.ErrTokenExpired) ||
+				errors.Is(err, service.ErrUserDisabled) {
+				writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Invalid token")
+				return
 			}
-			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-			w.Header().Set("Access-Control-Allow-Methods", s.deps.Cfg.CORSAllowedDefaultMethods)
-			// Credentials are cookies, authorization headers, or TLS client certificates
-			w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			s.logger(r).ErrorContext(r.Context(), "internal.server.middlewares.authMiddleware", "error", err)
+			writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+			return
 		}
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+
+		// Expose user to access log written by the outer middleware
+		if info := requestInfoFromContext(r.Context()); info != nil {
+			info.userId = user.Id
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, tokenIdContextKey, tokenId)
+		r = r.WithContext(ctx)
+		if !s.rateLimit(w, r, routeNameFromContext(ctx), RateLimitScopeUser) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow only administrators, must be wrapped by authMiddleware
+func (s *Server) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromContext(r.Context())
+		if !ok || !user.IsAdmin {
+			writeError(w, http.StatusForbidden, ErrorCodeForbidden, "Forbidden")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// responseRecorder captures status code and size of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.size += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Assign request ID, attach request-scoped logger and write access log record
+func (s *Server) requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestId := r.Header.Get(RequestIdHeader)
+		if !isValidRequestId(requestId) {
+			requestId = newRequestId()
+		}
+		w.Header().Set(RequestIdHeader, requestId)
+
+		info := &requestInfo{
+			id: requestId,
+			ip: s.clientIP(r),
+		}
+		info.log = s.deps.Log.With("request_id", requestId)
+
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		info.log.LogAttrs(ctx, slog.LevelInfo, "internal.server.middlewares.requestMiddleware",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("size", rec.size),
+			slog.String("remote_ip", info.ip),
+			slog.String("user_id", info.userId),
+		)
+	})
+}
+
+// Collect request count and latency metrics labeled by the matched route pattern
+func (s *Server) metricsMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		// Use pattern instead of raw path to keep labels cardinality bounded
+		route := routeLabel(mux, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		metrics.HTTPRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Start server span continuing W3C trace context of the incoming request
+func (s *Server) tracingMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := routeLabel(mux, r)
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
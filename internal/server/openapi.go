@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kompotkot/tripidium/internal/openapi"
+)
+
+// OpenAPIPath is where the OpenAPI document is served
+const OpenAPIPath = "/openapi.json"
+
+const bearerSecurityScheme = "bearerAuth"
+
+var pathParamRe = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// queryParam describes optional query parameter
+func queryParam(name, typ, format, description string) openapi.Parameter {
+	return openapi.Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &openapi.Schema{Type: typ, Format: format},
+	}
+}
+
+// BuildOpenAPI generates OpenAPI document from the route table
+func BuildOpenAPI(routes []Route) *openapi.Document {
+	doc := openapi.New("tripidium", strings.TrimPrefix(APIVersionPrefix, "/"))
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		bearerSecurityScheme: {Type: "http", Scheme: "bearer"},
+	}
+
+	for _, rt := range routes {
+		doc.AddOperation(openapiPath(rt.FullPath()), rt.Method, buildOperation(doc, rt, rt.Name, false))
+
+		if rt.Versioned && rt.LegacyAlias {
+			doc.AddOperation(openapiPath(rt.Path), rt.Method, buildOperation(doc, rt, rt.Name+"_legacy", true))
+		}
+	}
+
+	return doc
+}
+
+// openapiPath converts ServeMux wildcards like {path...} to OpenAPI templates
+func openapiPath(path string) string {
+	return pathParamRe.ReplaceAllString(path, "{$1}")
+}
+
+func buildOperation(doc *openapi.Document, rt Route, operationId string, deprecated bool) *openapi.Operation {
+	op := &openapi.Operation{
+		OperationId: operationId,
+		Summary:     rt.Doc.Summary,
+		Tags:        rt.Doc.Tags,
+		Deprecated:  deprecated,
+		Parameters:  append([]openapi.Parameter{}, rt.Doc.Params...),
+		Responses:   map[string]openapi.Response{},
+	}
+
+	for _, m := range pathParamRe.FindAllStringSubmatch(rt.Path, -1) {
+		op.Parameters = append(op.Parameters, openapi.Parameter{
+			Name: m[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"},
+		})
+	}
+
+	if rt.Doc.Request != nil {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				mediaTypeJSON: {Schema: doc.SchemaOf(rt.Doc.Request)},
+				mediaTypeForm: {Schema: doc.SchemaOf(rt.Doc.Request)},
+			},
+		}
+	}
+
+	successCode := http.StatusOK
+	if rt.Doc.Status != 0 {
+		successCode = rt.Doc.Status
+	}
+	success := openapi.Response{Description: http.StatusText(successCode)}
+	switch {
+	case rt.Doc.Response != nil:
+		success.Content = map[string]openapi.MediaType{"application/json": {Schema: doc.SchemaOf(rt.Doc.Response)}}
+	case rt.Doc.ContentType != "":
+		success.Content = map[string]openapi.MediaType{rt.Doc.ContentType: {Schema: &openapi.Schema{Type: "string"}}}
+	}
+	if deprecated {
+		success.Headers = map[string]openapi.Header{
+			"Deprecation": {Description: "Path is deprecated in favour of " + rt.FullPath(), Schema: &openapi.Schema{Type: "string"}},
+		}
+	}
+	op.Responses[strconv.Itoa(successCode)] = success
+
+	errorCodes := rt.Doc.Errors
+	if rt.Doc.Auth {
+		op.Security = []map[string][]string{{bearerSecurityScheme: {}}}
+		errorCodes = append([]int{http.StatusUnauthorized}, errorCodes...)
+	}
+	var errorSchema *openapi.Schema
+	if rt.Doc.ErrorResponse != nil {
+		errorSchema = doc.SchemaOf(rt.Doc.ErrorResponse)
+	} else {
+		errorSchema = doc.SchemaOf(ErrorResponse{})
+	}
+	for _, code := range errorCodes {
+		op.Responses[strconv.Itoa(code)] = openapi.Response{
+			Description: http.StatusText(code),
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: errorSchema}},
+		}
+	}
+
+	// Rate limits may be configured for any route
+	op.Responses[strconv.Itoa(http.StatusTooManyRequests)] = openapi.Response{
+		Description: http.StatusText(http.StatusTooManyRequests),
+		Headers: map[string]openapi.Header{
+			"Retry-After": {Description: "Seconds to wait before the next request", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+		},
+		Content: map[string]openapi.MediaType{"application/json": {Schema: doc.SchemaOf(ErrorResponse{})}},
+	}
+
+	return op
+}
+
+// openAPIHandler serves pre-rendered OpenAPI document
+func openAPIHandler(doc *openapi.Document) (http.Handler, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}), nil
+}
@@ -0,0 +1,494 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/config"
+	"github.com/kompotkot/tripidium/internal/health"
+	"github.com/kompotkot/tripidium/internal/openapi"
+	"github.com/kompotkot/tripidium/internal/ratelimit"
+	"github.com/kompotkot/tripidium/internal/types"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/db/memory"
+)
+
+// specScenario is a request expected to get the status from the route
+type specScenario struct {
+	name    string
+	handler http.Handler
+	route   string
+	path    string
+	// contentType of the body, JSON if empty
+	contentType string
+	body        string
+	token       string
+	// tls is the connection state of a service authenticated by client certificate
+	tls    *tls.ConnectionState
+	status int
+}
+
+// TestOpenAPIMatchesHandlers sends requests producing every documented
+// response and fails if a handler responds with a status, content type or
+// body not described by the generated document, or if a documented response
+// is never produced
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	ctx := context.Background()
+
+	database := newSpecDB(t)
+	var loadErr error
+	loadConfig := func() (*types.Config, error) {
+		cfg := config.Defaults()
+		cfg.Server.RateLimits = nil
+		return &cfg, loadErr
+	}
+
+	srv, handler := newSpecServer(t, database, func(deps *Dependencies) {
+		deps.LoadConfig = loadConfig
+		deps.Cfg.TLS.ServiceIdentities = map[string]bool{"billing": true}
+	})
+	_, noReload := newSpecServer(t, database, nil)
+	broken := newSpecDB(t)
+	_, brokenHandler := newSpecServer(t, broken, nil)
+	broken.Close()
+
+	// Every route allows a single request per hour
+	_, limited := newSpecServer(t, database, func(deps *Dependencies) {
+		for _, rt := range srv.Routes() {
+			deps.Cfg.RateLimits = append(deps.Cfg.RateLimits, types.RateLimit{
+				Route: rt.Name, Scope: RateLimitScopeIP, Requests: 1, Period: time.Hour,
+			})
+		}
+	})
+
+	userToken := specLogin(t, handler, "alice", true)
+	adminToken := specLogin(t, handler, "root", true)
+	admin, err := database.GetUser(ctx, "", "root")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	isAdmin := true
+	if _, err := database.UpdateUser(ctx, admin.Id, db.UserUpdate{IsAdmin: &isAdmin}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	specLogin(t, handler, "mallory", true)
+	mallory, err := database.GetUser(ctx, "", "mallory")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	isDisabled := true
+	if _, err := database.UpdateUser(ctx, mallory.Id, db.UserUpdate{IsDisabled: &isDisabled}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	credentials := `{"username":"alice","password":"correct-horse"}`
+	tooLarge := `{"username":"` + strings.Repeat("a", config.DefaultServerMaxBodyBytes) + `"}`
+
+	scenarios := []specScenario{
+		{name: "pong", route: "ping", status: http.StatusOK},
+		{name: "alive", route: "healthz", status: http.StatusOK},
+		{name: "build", route: "version", status: http.StatusOK},
+		{name: "ready", route: "readyz", status: http.StatusOK},
+		{name: "database down", handler: brokenHandler, route: "readyz", status: http.StatusServiceUnavailable},
+		{name: "metrics", route: "metrics", status: http.StatusOK},
+
+		{name: "new user", route: "signup", body: `{"username":"bob","password":"correct-horse"}`, status: http.StatusOK},
+		{name: "weak password", route: "signup", body: `{"username":"carol","password":"short"}`, status: http.StatusBadRequest},
+		{name: "malformed", route: "signup", body: `{`, status: http.StatusBadRequest},
+		{name: "existing user", route: "signup", body: credentials, status: http.StatusConflict},
+		{name: "too large", route: "signup", body: tooLarge, status: http.StatusRequestEntityTooLarge},
+		{name: "plain text", route: "signup", contentType: "text/plain", body: "alice", status: http.StatusUnsupportedMediaType},
+		{name: "database down", handler: brokenHandler, route: "signup", body: `{"username":"dave","password":"correct-horse"}`, status: http.StatusInternalServerError},
+
+		{name: "valid", route: "login", body: credentials, status: http.StatusOK},
+		{name: "missing password", route: "login", body: `{"username":"alice"}`, status: http.StatusBadRequest},
+		{name: "wrong password", route: "login", body: `{"username":"alice","password":"wrong-password"}`, status: http.StatusUnauthorized},
+		{name: "disabled", route: "login", body: `{"username":"mallory","password":"correct-horse"}`, status: http.StatusForbidden},
+		{name: "too large", route: "login", body: tooLarge, status: http.StatusRequestEntityTooLarge},
+		{name: "plain text", route: "login", contentType: "text/plain", body: "alice", status: http.StatusUnsupportedMediaType},
+		{name: "database down", handler: brokenHandler, route: "login", body: credentials, status: http.StatusInternalServerError},
+
+		{name: "valid", route: "refresh", token: specLogin(t, handler, "alice", false), status: http.StatusOK},
+		{name: "no token", route: "refresh", status: http.StatusUnauthorized},
+		{name: "service", route: "refresh", tls: serviceTLS("billing"), status: http.StatusBadRequest},
+		{name: "database down", handler: brokenHandler, route: "refresh", token: userToken, status: http.StatusInternalServerError},
+
+		{name: "valid", route: "logout", token: specLogin(t, handler, "alice", false), status: http.StatusNoContent},
+		{name: "no token", route: "logout", status: http.StatusUnauthorized},
+		{name: "service", route: "logout", tls: serviceTLS("billing"), status: http.StatusBadRequest},
+		{name: "database down", handler: brokenHandler, route: "logout", token: userToken, status: http.StatusInternalServerError},
+
+		{name: "valid", route: "user", token: userToken, status: http.StatusOK},
+		{name: "no token", route: "user", status: http.StatusUnauthorized},
+		{name: "database down", handler: brokenHandler, route: "user", token: userToken, status: http.StatusInternalServerError},
+
+		{name: "valid", route: "admin_audit", token: adminToken, status: http.StatusOK},
+		{name: "invalid limit", route: "admin_audit", path: "/v1/admin/audit?limit=0", token: adminToken, status: http.StatusBadRequest},
+		{name: "no token", route: "admin_audit", status: http.StatusUnauthorized},
+		{name: "not admin", route: "admin_audit", token: userToken, status: http.StatusForbidden},
+		{name: "database down", handler: brokenHandler, route: "admin_audit", token: adminToken, status: http.StatusInternalServerError},
+
+		{name: "valid", route: "admin_config_reload", token: adminToken, status: http.StatusOK},
+		{name: "no token", route: "admin_config_reload", status: http.StatusUnauthorized},
+		{name: "not admin", route: "admin_config_reload", token: userToken, status: http.StatusForbidden},
+		{name: "disabled", handler: noReload, route: "admin_config_reload", token: adminToken, status: http.StatusNotFound},
+		{name: "database down", handler: brokenHandler, route: "admin_config_reload", token: adminToken, status: http.StatusInternalServerError},
+	}
+
+	spec := fetchSpec(t, handler)
+	routes := map[string]Route{}
+	for _, rt := range srv.Routes() {
+		routes[rt.Name] = rt
+	}
+	covered := map[string]bool{}
+
+	check := func(t *testing.T, sc specScenario, resp *http.Response, body []byte) {
+		t.Helper()
+
+		op := spec.operation(sc.route)
+		if op == nil {
+			t.Fatalf("route %s is not documented", sc.route)
+		}
+		key := sc.route + " " + strconv.Itoa(resp.StatusCode)
+		covered[key] = true
+
+		documented, ok := op.Responses[strconv.Itoa(resp.StatusCode)]
+		if !ok {
+			t.Fatalf("status %d is not documented, body: %s", resp.StatusCode, body)
+		}
+		if err := spec.checkResponse(documented, resp.Header.Get("Content-Type"), body); err != nil {
+			t.Errorf("response %d drifted from the document: %v, body: %s", resp.StatusCode, err, body)
+		}
+	}
+
+	for _, sc := range scenarios {
+		t.Run(sc.route+"/"+sc.name, func(t *testing.T) {
+			if sc.handler == nil {
+				sc.handler = handler
+			}
+			resp, body := sendSpecRequest(sc, routes[sc.route])
+			if resp.StatusCode != sc.status {
+				t.Errorf("status = %d, want %d, body: %s", resp.StatusCode, sc.status, body)
+			}
+			check(t, sc, resp, body)
+		})
+	}
+
+	// The reload failing to load configuration
+	t.Run("admin_config_reload/invalid config", func(t *testing.T) {
+		loadErr = errors.New("invalid configuration")
+		defer func() { loadErr = nil }()
+
+		sc := specScenario{handler: handler, route: "admin_config_reload", token: adminToken, status: http.StatusUnprocessableEntity}
+		resp, body := sendSpecRequest(sc, routes[sc.route])
+		if resp.StatusCode != sc.status {
+			t.Errorf("status = %d, want %d, body: %s", resp.StatusCode, sc.status, body)
+		}
+		check(t, sc, resp, body)
+	})
+
+	// Any route may be rate limited
+	for _, rt := range srv.Routes() {
+		t.Run(rt.Name+"/rate limited", func(t *testing.T) {
+			sc := specScenario{handler: limited, route: rt.Name, status: http.StatusTooManyRequests}
+			sendSpecRequest(sc, rt)
+			resp, body := sendSpecRequest(sc, rt)
+			if resp.StatusCode != sc.status {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, sc.status, body)
+			}
+			if resp.Header.Get("Retry-After") == "" {
+				t.Errorf("Retry-After header is missing")
+			}
+			check(t, sc, resp, body)
+		})
+	}
+
+	for _, rt := range srv.Routes() {
+		op := spec.operation(rt.Name)
+		if op == nil {
+			continue
+		}
+		for status := range op.Responses {
+			key := rt.Name + " " + status
+			if !covered[key] {
+				t.Errorf("documented response %q is never produced by the handler", key)
+			}
+		}
+	}
+}
+
+// TestOpenAPIViewer checks that the viewer page is served only if enabled
+func TestOpenAPIViewer(t *testing.T) {
+	tests := []struct {
+		viewer bool
+		status int
+	}{
+		{true, http.StatusOK},
+		{false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		_, handler := newSpecServer(t, newSpecDB(t), func(deps *Dependencies) { deps.Cfg.OpenAPIViewer = tt.viewer })
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		if rec.Code != tt.status {
+			t.Errorf("viewer %v: status = %d, want %d", tt.viewer, rec.Code, tt.status)
+		}
+		if tt.viewer && !strings.Contains(rec.Body.String(), OpenAPIPath) {
+			t.Errorf("viewer page does not load %s", OpenAPIPath)
+		}
+	}
+}
+
+// newSpecDB returns migrated in-memory database
+func newSpecDB(t *testing.T) *memory.MemoryDB {
+	t.Helper()
+
+	database, err := memory.NewMemoryDB("")
+	if err != nil {
+		t.Fatalf("NewMemoryDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return database
+}
+
+// newSpecServer builds the handler with default configuration without rate
+// limits, configure adjusts dependencies
+func newSpecServer(t *testing.T, database db.Database, configure func(deps *Dependencies)) (*Server, http.Handler) {
+	t.Helper()
+
+	cfg := config.Defaults()
+	cfg.Server.RateLimits = nil
+
+	checker := health.NewChecker(0)
+	checker.Register("database", time.Second, health.DatabaseCheck(database))
+
+	deps := Dependencies{
+		DB:             database,
+		Cfg:            cfg.Server,
+		Log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Health:         checker,
+		RateLimitStore: ratelimit.NewMemoryStore(),
+		Config:         &cfg,
+	}
+	if configure != nil {
+		configure(&deps)
+	}
+
+	srv, err := NewServer(deps)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return srv, *srv.BuildCommonHandler()
+}
+
+// specLogin signs up the user if asked and returns a new token
+func specLogin(t *testing.T, handler http.Handler, username string, signUp bool) string {
+	t.Helper()
+
+	body := `{"username":"` + username + `","password":"correct-horse"}`
+	if signUp {
+		req := httptest.NewRequest(http.MethodPost, "/v1/signup", strings.NewReader(body))
+		req.Header.Set("Content-Type", mediaTypeJSON)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("sign up of %s: status %d, body: %s", username, rec.Code, rec.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", mediaTypeJSON)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var token TokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil || token.AccessToken == "" {
+		// Disabled users can not log in, the token is not needed for them
+		return ""
+	}
+	return token.AccessToken
+}
+
+// sendSpecRequest sends the scenario request to the route
+func sendSpecRequest(sc specScenario, rt Route) (*http.Response, []byte) {
+	path := sc.path
+	if path == "" {
+		path = rt.FullPath()
+	}
+
+	var body io.Reader
+	if sc.body != "" {
+		body = strings.NewReader(sc.body)
+	}
+	req := httptest.NewRequest(rt.Method, path, body)
+	if sc.body != "" {
+		contentType := sc.contentType
+		if contentType == "" {
+			contentType = mediaTypeJSON
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if sc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+sc.token)
+	}
+	req.TLS = sc.tls
+
+	rec := httptest.NewRecorder()
+	sc.handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, b
+}
+
+// specDocument is the served OpenAPI document
+type specDocument struct {
+	*openapi.Document
+}
+
+// fetchSpec reads the document served by the handler
+func fetchSpec(t *testing.T, handler http.Handler) specDocument {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", OpenAPIPath, rec.Code)
+	}
+
+	doc := &openapi.Document{}
+	if err := json.Unmarshal(rec.Body.Bytes(), doc); err != nil {
+		t.Fatalf("failed to decode OpenAPI document: %v", err)
+	}
+	return specDocument{doc}
+}
+
+// operation returns the operation with Id
+func (d specDocument) operation(operationId string) *openapi.Operation {
+	for _, item := range d.Paths {
+		for _, op := range item {
+			if op.OperationId == operationId {
+				return op
+			}
+		}
+	}
+	return nil
+}
+
+// checkResponse reports whether response content matches the documented one
+func (d specDocument) checkResponse(documented openapi.Response, contentType string, body []byte) error {
+	if len(documented.Content) == 0 {
+		if len(body) > 0 {
+			return errors.New("undocumented response body")
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	content, ok := documented.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %s is not documented", mediaType)
+	}
+	if mediaType != mediaTypeJSON {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return d.checkValue(content.Schema, value, "$")
+}
+
+// checkValue validates decoded JSON value against the schema
+func (d specDocument) checkValue(schema *openapi.Schema, value any, path string) error {
+	if ref, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/"); ok {
+		resolved, ok := d.Components.Schemas[ref]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", path, schema.Ref)
+		}
+		schema = resolved
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: got %T, want object", path, value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: required property %s is missing", path, name)
+			}
+		}
+		for name, v := range obj {
+			propSchema := schema.AdditionalProperties
+			if p, ok := schema.Properties[name]; ok {
+				propSchema = p
+			}
+			if propSchema == nil {
+				return fmt.Errorf("%s: undocumented property %s", path, name)
+			}
+			if err := d.checkValue(propSchema, v, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: got %T, want array", path, value)
+		}
+		for i, item := range items {
+			if err := d.checkValue(schema.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: got %T, want string", path, value)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: %q is not date-time", path, s)
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: got %v, want integer", path, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: got %T, want number", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: got %T, want boolean", path, value)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %s", path, schema.Type)
+	}
+	return nil
+}
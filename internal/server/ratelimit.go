@@ -0,0 +1,156 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/ratelimit"
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// Rate limit scopes define the subject requests are counted for
+const (
+	RateLimitScopeIP    = "ip"
+	RateLimitScopeUser  = "user"
+	RateLimitScopeRoute = "route"
+)
+
+// rateLimitsByRoute groups configured limits by route name
+func rateLimitsByRoute(limits []types.RateLimit) map[string][]types.RateLimit {
+	byRoute := map[string][]types.RateLimit{}
+	for _, l := range limits {
+		byRoute[l.Route] = append(byRoute[l.Route], l)
+	}
+	return byRoute
+}
+
+// checkRateLimits rejects limits of routes missing in the route table
+func checkRateLimits(limits []types.RateLimit, routes map[string]bool) error {
+	for _, l := range limits {
+		if !routes[l.Route] {
+			return fmt.Errorf("rate limit route %s is not in the route table", l.Route)
+		}
+	}
+	return nil
+}
+
+// takenRateLimit is a request recorded for the key
+type takenRateLimit struct {
+	key   string
+	limit ratelimit.Limit
+}
+
+// appliedRateLimit is a limit result reported in RateLimit-* headers
+type appliedRateLimit struct {
+	result ratelimit.Result
+	policy types.RateLimit
+}
+
+// stricter reports whether result a restricts the client more than b
+func stricter(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	return a.Remaining < b.Remaining
+}
+
+// rateLimit applies limits of the route in given scopes, the most restrictive
+// result of all calls for the request is reported in RateLimit-* headers.
+// When a limit is exceeded 429 is written, requests taken by other limits of
+// the request are refunded and false returned. Store failures do not block
+// requests.
+func (s *Server) rateLimit(w http.ResponseWriter, r *http.Request, route string, scopes ...string) bool {
+	store := s.deps.RateLimitStore
+	limits := s.runtime.load().rateLimits[route]
+	if store == nil || len(limits) == 0 {
+		return true
+	}
+
+	var (
+		strictest ratelimit.Result
+		policy    types.RateLimit
+		found     bool
+		taken     []takenRateLimit
+	)
+	now := time.Now()
+	for _, l := range limits {
+		if !slices.Contains(scopes, l.Scope) {
+			continue
+		}
+
+		var subject string
+		switch l.Scope {
+		case RateLimitScopeIP:
+			subject = s.clientIP(r)
+		case RateLimitScopeUser:
+			user, ok := userFromContext(r.Context())
+			if !ok {
+				continue
+			}
+			subject = user.Id
+		}
+
+		key := route + ":" + l.Scope + ":" + subject
+		limit := ratelimit.Limit{Requests: l.Requests, Period: l.Period}
+		res, err := ratelimit.Take(r.Context(), store, key, limit, now)
+		if err != nil {
+			s.logger(r).ErrorContext(r.Context(), "internal.server.ratelimit.rateLimit", "key", key, "error", err)
+			continue
+		}
+		if res.Allowed {
+			taken = append(taken, takenRateLimit{key: key, limit: limit})
+		}
+
+		if !found || stricter(res, strictest) {
+			strictest, policy, found = res, l, true
+		}
+		if !res.Allowed {
+			break
+		}
+	}
+	if !found {
+		return true
+	}
+
+	// Limits of earlier calls, e.g. IP scope before user scope, may be stricter
+	info := requestInfoFromContext(r.Context())
+	h := w.Header()
+	if info == nil || info.rateLimit == nil || stricter(strictest, info.rateLimit.result) {
+		h.Set("RateLimit-Limit", strconv.Itoa(strictest.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(strictest.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(strictest.Reset)))
+		h.Set("RateLimit-Policy", strconv.Itoa(policy.Requests)+";w="+strconv.Itoa(ceilSeconds(policy.Period)))
+		if info != nil {
+			info.rateLimit = &appliedRateLimit{result: strictest, policy: policy}
+		}
+	}
+
+	if !strictest.Allowed {
+		// Denied request must not count against limits of other scopes
+		if info != nil {
+			taken = append(taken, info.rateLimits...)
+			info.rateLimits = nil
+		}
+		for _, t := range taken {
+			if err := ratelimit.Refund(r.Context(), store, t.key, t.limit); err != nil {
+				s.logger(r).ErrorContext(r.Context(), "internal.server.ratelimit.rateLimit", "key", t.key, "error", err)
+			}
+		}
+
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(strictest.RetryAfter)))
+		writeError(w, http.StatusTooManyRequests, ErrorCodeRateLimited, "Too many requests")
+		return false
+	}
+	if info != nil {
+		info.rateLimits = append(info.rateLimits, taken...)
+	}
+	return true
+}
+
+// ceilSeconds rounds duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/config"
+	"github.com/kompotkot/tripidium/internal/ratelimit"
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// TestRateLimitUnknownRoute checks that rate limits may refer only to routes
+// of the table, including routes passed to NewServer and documentation routes
+func TestRateLimitUnknownRoute(t *testing.T) {
+	database := newSpecDB(t)
+	newServer := func(viewer bool, route string, routes ...Route) error {
+		cfg := config.Defaults()
+		cfg.Server.OpenAPIViewer = viewer
+		cfg.Server.RateLimits = []types.RateLimit{{Route: route, Scope: RateLimitScopeIP, Requests: 1, Period: time.Minute}}
+		_, err := NewServer(Dependencies{DB: database, Cfg: cfg.Server, Config: &cfg}, routes...)
+		return err
+	}
+	extra := Route{Name: "report", Method: http.MethodGet, Path: "/report", Handler: http.NotFoundHandler()}
+
+	tests := []struct {
+		name    string
+		viewer  bool
+		route   string
+		routes  []Route
+		wantErr bool
+	}{
+		{"built-in route", false, "login", nil, false},
+		{"OpenAPI document", false, "openapi", nil, false},
+		{"viewer", true, "docs", nil, false},
+		{"disabled viewer", false, "docs", nil, true},
+		{"route passed to NewServer", false, "report", []Route{extra}, false},
+		{"unknown route", false, "report", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newServer(tt.viewer, tt.route, tt.routes...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if want := "rate limit route " + tt.route + " is not in the route table"; err != nil && err.Error() != want {
+				t.Errorf("error = %v, want %s", err, want)
+			}
+		})
+	}
+}
+
+// TestRateLimitReloadUnknownRoute checks that reload rejects limits of
+// unknown routes and keeps the running ones
+func TestRateLimitReloadUnknownRoute(t *testing.T) {
+	srv, _ := newSpecServer(t, newSpecDB(t), func(deps *Dependencies) {
+		deps.LoadConfig = func() (*types.Config, error) {
+			cfg := config.Defaults()
+			cfg.Server.RateLimits = []types.RateLimit{{Route: "signin", Scope: RateLimitScopeIP, Requests: 1, Period: time.Minute}}
+			return &cfg, nil
+		}
+	})
+
+	_, err := srv.ReloadConfig(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "rate limit route signin is not in the route table") {
+		t.Fatalf("error = %v, want unknown route error", err)
+	}
+	if limits := srv.runtime.load().rateLimits; len(limits) != 0 {
+		t.Errorf("rate limits = %v, want running ones", limits)
+	}
+}
+
+// TestRateLimitStrictestHeaders checks that the user scope applied by
+// authMiddleware does not hide a stricter limit applied by routeHandler
+func TestRateLimitStrictestHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		ip, user      int
+		wantLimit     string
+		wantRemaining string
+	}{
+		{"IP stricter", 1, 6, "1", "0"},
+		{"user stricter", 6, 1, "1", "0"},
+		{"IP with remaining requests", 3, 6, "3", "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newSpecDB(t)
+			_, handler := newSpecServer(t, database, func(deps *Dependencies) {
+				deps.Cfg.RateLimits = []types.RateLimit{
+					{Route: "user", Scope: RateLimitScopeIP, Requests: tt.ip, Period: time.Hour},
+					{Route: "user", Scope: RateLimitScopeUser, Requests: tt.user, Period: time.Hour},
+				}
+			})
+			token := specLogin(t, handler, "alice", true)
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/user", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("RateLimit-Limit"); got != tt.wantLimit {
+				t.Errorf("RateLimit-Limit = %s, want %s", got, tt.wantLimit)
+			}
+			if got := rec.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("RateLimit-Remaining = %s, want %s", got, tt.wantRemaining)
+			}
+			if got, want := rec.Header().Get("RateLimit-Policy"), tt.wantLimit+";w=3600"; got != want {
+				t.Errorf("RateLimit-Policy = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// TestRateLimitRefundOnDenial checks that a request denied by a limit of one
+// scope is not counted by limits of other scopes
+func TestRateLimitRefundOnDenial(t *testing.T) {
+	database := newSpecDB(t)
+	store := ratelimit.NewMemoryStore()
+	_, handler := newSpecServer(t, database, func(deps *Dependencies) {
+		deps.RateLimitStore = store
+		deps.Cfg.RateLimits = []types.RateLimit{
+			{Route: "user", Scope: RateLimitScopeIP, Requests: 2, Period: time.Hour},
+			{Route: "user", Scope: RateLimitScopeUser, Requests: 1, Period: time.Hour},
+			{Route: "signup", Scope: RateLimitScopeIP, Requests: 2, Period: time.Hour},
+			{Route: "signup", Scope: RateLimitScopeRoute, Requests: 1, Period: time.Hour},
+		}
+	})
+
+	getUser := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/user", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	signUp := func(username string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/signup", strings.NewReader(`{"username":"`+username+`","password":"correct-horse"}`))
+		req.Header.Set("Content-Type", mediaTypeJSON)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Limits applied by different middlewares
+	if status := signUp("alice"); status != http.StatusOK {
+		t.Fatalf("sign up status = %d, want %d", status, http.StatusOK)
+	}
+	alice := specLogin(t, handler, "alice", false)
+	// Sign up of bob would be limited too
+	user, err := database.CreateUser(context.Background(), "bob", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token, err := database.CreateToken(context.Background(), user.Id, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	bob := token.Id
+
+	steps := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"first request of alice", alice, http.StatusOK},
+		{"alice over user limit", alice, http.StatusTooManyRequests},
+		// Denied request of alice is refunded to the IP limit
+		{"first request of bob", bob, http.StatusOK},
+		{"IP limit reached", bob, http.StatusTooManyRequests},
+	}
+	for _, step := range steps {
+		if status := getUser(step.token); status != step.status {
+			t.Errorf("%s: status = %d, want %d", step.name, status, step.status)
+		}
+	}
+
+	// Limits applied together, signup of alice took the single route request
+	if status := signUp("carol"); status != http.StatusTooManyRequests {
+		t.Fatalf("sign up over route limit: status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+	res, err := ratelimit.Take(context.Background(), store, "signup:ip:192.0.2.1", ratelimit.Limit{Requests: 2, Period: time.Hour}, time.Now())
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("IP limit after refund: allowed = %v, remaining = %d, want true, 0", res.Allowed, res.Remaining)
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/kompotkot/tripidium/internal/buildinfo"
+	"github.com/kompotkot/tripidium/internal/health"
+	"github.com/kompotkot/tripidium/internal/metrics"
+	"github.com/kompotkot/tripidium/internal/openapi"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// APIVersionPrefix is the path prefix of the current API version
+const APIVersionPrefix = "/v1"
+
+// Route describes a single endpoint of the route table
+type Route struct {
+	// Name identifies the route, e.g. in generated documentation
+	Name string
+	// Method is an HTTP method, GET routes also serve HEAD requests
+	Method string
+	// Path is a ServeMux path pattern which may contain {wildcards}
+	Path string
+	// Versioned routes are mounted under APIVersionPrefix
+	Versioned bool
+	// LegacyAlias keeps versioned route reachable at the bare path with Deprecation header
+	LegacyAlias bool
+	Handler     http.Handler
+	// MaxBodyBytes overrides ServerConfig.MaxBodyBytes limit of request body
+	MaxBodyBytes int64
+	// SecurityHeaders override default security headers, empty value removes the header
+	SecurityHeaders map[string]string
+	// CORS overrides default policy configured by SERVER_CORS_* variables
+	CORS *CORSPolicy
+	// Doc describes the route in the OpenAPI document
+	Doc RouteDoc
+}
+
+// RouteDoc holds OpenAPI metadata of a route
+type RouteDoc struct {
+	Summary string
+	Tags    []string
+	// Auth routes require bearer token
+	Auth bool
+	// Params lists query parameters, path parameters are taken from the pattern
+	Params []openapi.Parameter
+	// Request is a value of JSON or form encoded request body type
+	Request any
+	// Response is a value of JSON response body type
+	Response any
+	// ContentType of non JSON response, e.g. text/plain
+	ContentType string
+	// Status of successful response, 200 by default
+	Status int
+	// Errors lists status codes of error responses, 401 of Auth routes and
+	// 429 of rate limits are documented for all routes
+	Errors []int
+	// ErrorResponse is a value of error body type, ErrorResponse by default
+	ErrorResponse any
+}
+
+// Pattern returns method-aware ServeMux pattern of the route
+func (rt Route) Pattern() string {
+	return rt.Method + " " + rt.FullPath()
+}
+
+// FullPath returns path including API version prefix
+func (rt Route) FullPath() string {
+	if rt.Versioned {
+		return APIVersionPrefix + rt.Path
+	}
+	return rt.Path
+}
+
+// Routes returns built-in routes followed by routes passed to NewServer
+func (s *Server) Routes() []Route {
+	h := s.newHandlers()
+
+	routes := []Route{
+		{
+			Name: "ping", Method: http.MethodGet, Path: "/ping",
+			Handler: http.HandlerFunc(h.Ping),
+			CORS:    PublicCORSPolicy,
+			Doc:     RouteDoc{Summary: "Ping-pong", Tags: []string{"system"}, ContentType: "text/plain"},
+		},
+		{
+			Name: "healthz", Method: http.MethodGet, Path: "/healthz",
+			Handler: http.HandlerFunc(h.Healthz),
+			CORS:    PublicCORSPolicy,
+			Doc:     RouteDoc{Summary: "Liveness", Tags: []string{"system"}, Response: StatusResponse{}},
+		},
+		{
+			Name: "version", Method: http.MethodGet, Path: "/version",
+			Handler: http.HandlerFunc(h.Version),
+			CORS:    PublicCORSPolicy,
+			Doc:     RouteDoc{Summary: "Build information", Tags: []string{"system"}, Response: buildinfo.Info{}},
+		},
+		{
+			Name: "readyz", Method: http.MethodGet, Path: "/readyz",
+			Handler: http.HandlerFunc(h.Readyz),
+			CORS:    PublicCORSPolicy,
+			Doc: RouteDoc{
+				Summary: "Readiness with per-check details", Tags: []string{"system"},
+				Response: health.Report{}, Errors: []int{http.StatusServiceUnavailable},
+				ErrorResponse: health.Report{},
+			},
+		},
+		{
+			Name: "signup", Method: http.MethodPost, Path: "/signup", Versioned: true, LegacyAlias: true,
+			Handler: http.HandlerFunc(h.SignUp),
+			Doc: RouteDoc{
+				Summary: "Register new user", Tags: []string{"users"},
+				Request: SignUpRequest{}, Response: UserResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			},
+		},
+		{
+			Name: "login", Method: http.MethodPost, Path: "/login", Versioned: true, LegacyAlias: true,
+			Handler: http.HandlerFunc(h.Login),
+			Doc: RouteDoc{
+				Summary: "Issue access token", Tags: []string{"auth"},
+				Request: LoginRequest{}, Response: TokenResponse{},
+				Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+			},
+		},
+		{
+			Name: "refresh", Method: http.MethodPost, Path: "/refresh", Versioned: true, LegacyAlias: true,
+			Handler: s.authMiddleware(http.HandlerFunc(h.Refresh)),
+			Doc: RouteDoc{
+				Summary: "Replace access token with a new one", Tags: []string{"auth"}, Auth: true,
+				Response: TokenResponse{}, Errors: []int{http.StatusBadRequest, http.StatusInternalServerError},
+			},
+		},
+		{
+			Name: "logout", Method: http.MethodPost, Path: "/logout", Versioned: true, LegacyAlias: true,
+			Handler: s.authMiddleware(http.HandlerFunc(h.Logout)),
+			Doc: RouteDoc{
+				Summary: "Revoke access token", Tags: []string{"auth"}, Auth: true,
+				Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest, http.StatusInternalServerError},
+			},
+		},
+		{
+			Name: "user", Method: http.MethodGet, Path: "/user", Versioned: true, LegacyAlias: true,
+			Handler: s.authMiddleware(http.HandlerFunc(h.User)),
+			Doc: RouteDoc{
+				Summary: "Current user", Tags: []string{"users"}, Auth: true,
+				Response: UserResponse{}, Errors: []int{http.StatusInternalServerError},
+			},
+		},
+		{
+			Name: "admin_audit", Method: http.MethodGet, Path: "/admin/audit", Versioned: true, LegacyAlias: true,
+			Handler: s.authMiddleware(s.adminMiddleware(http.HandlerFunc(h.AuditEvents))),
+			Doc: RouteDoc{
+				Summary: "Query audit events", Tags: []string{"admin"}, Auth: true,
+				Params: []openapi.Parameter{
+					queryParam("actor", "string", "", "Actor user ID"),
+					queryParam("action", "string", "", "Event action, e.g. user.signup"),
+					queryParam("target", "string", "", "Event target"),
+					queryParam("result", "string", "", "Event result, success or failure"),
+					queryParam("since", "string", "date-time", "Events created at or after RFC3339 time"),
+					queryParam("until", "string", "date-time", "Events created before RFC3339 time"),
+					queryParam("after_id", "integer", "int64", "Events with greater ID, used for pagination"),
+					queryParam("limit", "integer", "int32", "Maximum number of events between 1 and 1000, default 100"),
+				},
+				Response: []iam.AuditEvent{},
+				Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+			},
+		},
+		{
+			Name: "admin_config_reload", Method: http.MethodPost, Path: "/admin/config/reload", Versioned: true,
+			Handler: s.authMiddleware(s.adminMiddleware(http.HandlerFunc(h.ReloadConfig))),
+			Doc: RouteDoc{
+				Summary: "Reload log level, CORS whitelist, rate limits and password policy", Tags: []string{"admin"}, Auth: true,
+				Response: ReloadResult{},
+				Errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+			},
+		},
+	}
+
+	// Expose metrics on the main listener if there is no admin one
+	if s.deps.Cfg.AdminPort == "" {
+		routes = append(routes, Route{
+			Name: "metrics", Method: http.MethodGet, Path: "/metrics",
+			Handler: metrics.Handler(),
+			Doc:     RouteDoc{Summary: "Prometheus metrics", Tags: []string{"system"}, ContentType: "text/plain"},
+		})
+	}
+
+	return append(routes, s.extraRoutes...)
+}
+
+// routeNames returns names of the route table including documentation routes
+// added by BuildCommonHandler
+func (s *Server) routeNames() map[string]bool {
+	names := map[string]bool{"openapi": true}
+	if s.deps.Cfg.OpenAPIViewer {
+		names["docs"] = true
+	}
+	for _, rt := range s.Routes() {
+		names[rt.Name] = true
+	}
+	return names
+}
+
+// registerRoutes mounts routes and deprecated aliases on the mux, requests
+// with not allowed methods get 405 with Allow header from the ServeMux
+func (s *Server) registerRoutes(mux *http.ServeMux, routes []Route) {
+	for _, rt := range routes {
+		handler := s.routeHandler(rt)
+		mux.Handle(rt.Pattern(), handler)
+
+		if rt.Versioned && rt.LegacyAlias {
+			mux.Handle(rt.Method+" "+rt.Path, deprecatedAlias(rt.FullPath(), handler))
+		}
+	}
+}
+
+// routeHandler applies request body limit, rate limits and security header overrides of the route
+func (s *Server) routeHandler(rt Route) http.Handler {
+	limit := s.deps.Cfg.MaxBodyBytes
+	if rt.MaxBodyBytes > 0 {
+		limit = rt.MaxBodyBytes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		// User scoped limits are applied by authMiddleware once the user is known
+		r = r.WithContext(context.WithValue(r.Context(), routeNameContextKey, rt.Name))
+		if !s.rateLimit(w, r, rt.Name, RateLimitScopeIP, RateLimitScopeRoute) {
+			return
+		}
+
+		for name, value := range rt.SecurityHeaders {
+			if value == "" {
+				w.Header().Del(name)
+				continue
+			}
+			w.Header().Set(name, value)
+		}
+		rt.Handler.ServeHTTP(w, r)
+	})
+}
+
+// deprecatedAlias marks responses of unversioned paths as deprecated pointing to the successor
+func deprecatedAlias(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeLabel returns matched route pattern without method for metrics and spans
+func routeLabel(mux *http.ServeMux, r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kompotkot/tripidium/internal/config"
+	"github.com/kompotkot/tripidium/internal/logger"
+	"github.com/kompotkot/tripidium/internal/service"
+	"github.com/kompotkot/tripidium/internal/types"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// ErrReloadDisabled is returned on reload without Dependencies.LoadConfig
+var ErrReloadDisabled = errors.New("configuration reload is not configured")
+
+// reloadableSettings are variables applied by reload without restart,
+// entries ending with underscore match all variables of the prefix
+var reloadableSettings = []string{
+	"LOG_LEVEL",
+	"SERVER_CORS_WHITELIST",
+	"SERVER_RATE_LIMITS",
+	"SERVER_PASSWORD_",
+}
+
+// runtimeConfig is an immutable snapshot of settings changeable at runtime
+type runtimeConfig struct {
+	corsDefault    *corsPolicy
+	rateLimits     map[string][]types.RateLimit
+	passwordPolicy types.PasswordPolicy
+}
+
+// runtime holds the current snapshot of runtime settings shared by
+// middlewares and handlers, a reload swaps it atomically
+type runtime struct {
+	deps    Dependencies
+	current atomic.Pointer[runtimeConfig]
+
+	// routeNames are names of the route table rate limits may refer to
+	routeNames map[string]bool
+
+	// mu serializes reloads
+	mu     sync.Mutex
+	config *types.Config
+}
+
+// ReloadResult lists variables changed by configuration reload
+type ReloadResult struct {
+	// Applied settings are in effect
+	Applied []string `json:"applied"`
+	// RestartRequired settings changed but take effect only after restart
+	RestartRequired []string `json:"restart_required"`
+}
+
+func newRuntime(deps Dependencies) *runtime {
+	rt := &runtime{deps: deps, config: deps.Config}
+	rt.current.Store(newRuntimeConfig(deps.Cfg))
+	return rt
+}
+
+// newRuntimeConfig prepares snapshot of runtime settings
+func newRuntimeConfig(cfg types.ServerConfig) *runtimeConfig {
+	return &runtimeConfig{
+		corsDefault:    defaultCORSPolicy(cfg).compile(),
+		rateLimits:     rateLimitsByRoute(cfg.RateLimits),
+		passwordPolicy: cfg.PasswordPolicy,
+	}
+}
+
+// load returns the current snapshot
+func (rt *runtime) load() *runtimeConfig {
+	return rt.current.Load()
+}
+
+// reload loads configuration from its sources and applies reloadable
+// settings, an invalid configuration is rejected as a whole. Every attempt is
+// recorded to the audit log with the event filled by the caller, e.g. actor.
+func (rt *runtime) reload(ctx context.Context, event iam.AuditEvent) (ReloadResult, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	event.Action = iam.AuditActionConfigReload
+	event.Target = "config"
+
+	result := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	if rt.deps.LoadConfig == nil || rt.config == nil {
+		return result, ErrReloadDisabled
+	}
+
+	cfg, err := rt.deps.LoadConfig()
+	if err == nil {
+		err = checkRateLimits(cfg.Server.RateLimits, rt.routeNames)
+	}
+	if err != nil {
+		event.Result = iam.AuditResultFailure
+		rt.audit(ctx, event)
+		return result, err
+	}
+
+	for _, setting := range changedSettings(rt.config, cfg) {
+		if isReloadable(setting) {
+			result.Applied = append(result.Applied, setting)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, setting)
+		}
+	}
+
+	// Keep settings requiring restart as they are running now
+	applied := *rt.config
+	applied.Logger.Level = cfg.Logger.Level
+	applied.Server.CORSWhitelist = cfg.Server.CORSWhitelist
+	applied.Server.RateLimits = cfg.Server.RateLimits
+	applied.Server.PasswordPolicy = cfg.Server.PasswordPolicy
+
+	logger.SetLevel(applied.Logger.Level)
+	rt.current.Store(newRuntimeConfig(applied.Server))
+	rt.config = &applied
+
+	if len(result.Applied) > 0 {
+		event.Target = "config:" + strings.Join(result.Applied, ",")
+	}
+	event.Result = iam.AuditResultSuccess
+	rt.audit(ctx, event)
+
+	rt.deps.Log.InfoContext(ctx, "Configuration reloaded", "applied", result.Applied, "restart_required", result.RestartRequired)
+	return result, nil
+}
+
+// audit records reload event, failures are only logged
+func (rt *runtime) audit(ctx context.Context, event iam.AuditEvent) {
+	if _, err := service.RecordAuditEvent(ctx, rt.deps.DB, event); err != nil {
+		rt.deps.Log.ErrorContext(ctx, "internal.server.runtime.audit", "action", event.Action, "error", err)
+	}
+}
+
+// changedSettings returns names of variables with different effective values
+func changedSettings(prev, next *types.Config) []string {
+	prevValues := map[string]string{}
+	for _, line := range strings.Split(config.Dump(prev), "\n") {
+		name, value, _ := strings.Cut(line, "=")
+		prevValues[name] = value
+	}
+
+	var changed []string
+	for _, line := range strings.Split(config.Dump(next), "\n") {
+		name, value, _ := strings.Cut(line, "=")
+		if name != "" && prevValues[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+func isReloadable(setting string) bool {
+	return slices.ContainsFunc(reloadableSettings, func(prefix string) bool {
+		if strings.HasSuffix(prefix, "_") {
+			return strings.HasPrefix(setting, prefix)
+		}
+		return setting == prefix
+	})
+}
+
+// ReloadConfig loads configuration again and applies log level, CORS
+// whitelist, rate limits and password policy without restart
+func (s *Server) ReloadConfig(ctx context.Context) (ReloadResult, error) {
+	return s.runtime.reload(ctx, iam.AuditEvent{})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/logger"
+	"github.com/kompotkot/tripidium/internal/types"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+func TestReloadConfig(t *testing.T) {
+	log := logger.New(types.LoggerConfig{Level: "info"})
+	t.Cleanup(func() { logger.SetLevel("info") })
+
+	database := newSpecDB(t)
+	var (
+		next    types.Config
+		loadErr error
+	)
+	s, _ := newSpecServer(t, database, func(deps *Dependencies) {
+		deps.LoadConfig = func() (*types.Config, error) {
+			if loadErr != nil {
+				return nil, loadErr
+			}
+			cfg := next
+			return &cfg, nil
+		}
+	})
+	initial := *s.runtime.config
+
+	next = initial
+	next.Logger.Level = "debug"
+	next.Server.CORSWhitelist = map[string]bool{"https://app.example.com": true}
+	next.Server.RateLimits = []types.RateLimit{{Route: "login", Scope: RateLimitScopeIP, Requests: 5, Period: time.Minute}}
+	next.Server.PasswordPolicy.MinLength = 12
+	next.Server.PasswordPolicy.RequireDigit = true
+	next.Server.Port = "9090"
+	next.Database.URI = "postgres://tripidium:secret@db/tripidium"
+
+	res, err := s.ReloadConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+
+	wantApplied := []string{
+		"LOG_LEVEL",
+		"SERVER_CORS_WHITELIST",
+		"SERVER_PASSWORD_MIN_LENGTH",
+		"SERVER_PASSWORD_REQUIRE_DIGIT",
+		"SERVER_RATE_LIMITS",
+	}
+	if got := slices.Sorted(slices.Values(res.Applied)); !slices.Equal(got, wantApplied) {
+		t.Errorf("Applied = %v, want %v", got, wantApplied)
+	}
+	wantRestart := []string{"DATABASE_URI", "SERVER_PORT"}
+	if got := slices.Sorted(slices.Values(res.RestartRequired)); !slices.Equal(got, wantRestart) {
+		t.Errorf("RestartRequired = %v, want %v", got, wantRestart)
+	}
+
+	rt := s.runtime.load()
+	if rt.passwordPolicy != next.Server.PasswordPolicy {
+		t.Errorf("password policy = %+v, want %+v", rt.passwordPolicy, next.Server.PasswordPolicy)
+	}
+	if got := rt.rateLimits["login"]; !slices.Equal(got, next.Server.RateLimits) {
+		t.Errorf("login rate limits = %v, want %v", got, next.Server.RateLimits)
+	}
+	if len(rt.rateLimits) != 1 {
+		t.Errorf("rate limits of %d routes, want 1", len(rt.rateLimits))
+	}
+	if !rt.corsDefault.allowOrigin("https://app.example.com") || rt.corsDefault.allowOrigin("https://other.example.com") {
+		t.Error("CORS whitelist is not applied")
+	}
+	if !log.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("log level is not applied")
+	}
+
+	// Settings requiring restart keep running values
+	applied := s.runtime.config
+	if applied.Server.Port != initial.Server.Port || applied.Database.URI != initial.Database.URI {
+		t.Errorf("port %s and database URI %s changed, want %s and %s",
+			applied.Server.Port, applied.Database.URI, initial.Server.Port, initial.Database.URI)
+	}
+
+	// Reload of the same configuration applies nothing new
+	res, err = s.ReloadConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if len(res.Applied) != 0 {
+		t.Errorf("Applied = %v on repeated reload, want none", res.Applied)
+	}
+	if got := slices.Sorted(slices.Values(res.RestartRequired)); !slices.Equal(got, wantRestart) {
+		t.Errorf("RestartRequired = %v on repeated reload, want %v", got, wantRestart)
+	}
+
+	// Rejected configuration keeps the current snapshot
+	rt = s.runtime.load()
+	invalid := next
+	invalid.Server.RateLimits = []types.RateLimit{{Route: "missing", Scope: RateLimitScopeIP, Requests: 1, Period: time.Second}}
+	next = invalid
+	if _, err := s.ReloadConfig(context.Background()); err == nil {
+		t.Error("ReloadConfig accepted rate limit of unknown route")
+	}
+	loadErr = errors.New("invalid SERVER_PORT")
+	if _, err := s.ReloadConfig(context.Background()); !errors.Is(err, loadErr) {
+		t.Errorf("ReloadConfig = %v, want %v", err, loadErr)
+	}
+	if s.runtime.load() != rt {
+		t.Error("runtime settings changed by rejected configuration")
+	}
+
+	events, err := database.ListAuditEvents(context.Background(), db.AuditEventFilter{Action: iam.AuditActionConfigReload})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	var results []string
+	for _, e := range events {
+		results = append(results, e.Result)
+	}
+	wantResults := []string{iam.AuditResultSuccess, iam.AuditResultSuccess, iam.AuditResultFailure, iam.AuditResultFailure}
+	if !slices.Equal(results, wantResults) {
+		t.Errorf("audit results = %v, want %v", results, wantResults)
+	}
+}
+
+func TestReloadDisabled(t *testing.T) {
+	s, _ := newSpecServer(t, newSpecDB(t), nil)
+	if _, err := s.ReloadConfig(context.Background()); !errors.Is(err, ErrReloadDisabled) {
+		t.Errorf("ReloadConfig = %v, want %v", err, ErrReloadDisabled)
+	}
+}
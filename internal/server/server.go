@@ -4,41 +4,115 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/kompotkot/tripidium/internal/health"
+	"github.com/kompotkot/tripidium/internal/metrics"
+	"github.com/kompotkot/tripidium/internal/openapi"
+	"github.com/kompotkot/tripidium/internal/ratelimit"
 	"github.com/kompotkot/tripidium/internal/types"
 	"github.com/kompotkot/tripidium/pkg/db"
 )
 
 // Deps holds server dependencies
 type Dependencies struct {
-	DB  db.Database
-	Cfg types.ServerConfig
-	Log *slog.Logger
+	DB     db.Database
+	Cfg    types.ServerConfig
+	Log    *slog.Logger
+	Health *health.Checker
+	// RateLimitStore keeps rate limit state, limits are disabled if nil
+	RateLimitStore ratelimit.Store
+	// Config is the whole loaded configuration, Cfg is its server section
+	Config *types.Config
+	// LoadConfig loads configuration again on reload, reload is disabled if nil
+	LoadConfig func() (*types.Config, error)
 }
 
 // Server holds server state and dependencies
 type Server struct {
-	deps Dependencies
+	deps        Dependencies
+	extraRoutes []Route
+	runtime     *runtime
 }
 
-// NewServer creates a new server instance with dependencies
-func NewServer(deps Dependencies) *Server {
-	return &Server{deps: deps}
+// NewServer creates a new server instance with dependencies, routes extend
+// the built-in route table. Rate limits of routes missing in the table are
+// rejected.
+func NewServer(deps Dependencies, routes ...Route) (*Server, error) {
+	s := &Server{
+		deps:        deps,
+		extraRoutes: routes,
+		runtime:     newRuntime(deps),
+	}
+	s.runtime.routeNames = s.routeNames()
+	if err := checkRateLimits(deps.Cfg.RateLimits, s.runtime.routeNames); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 // BuildCommonHandler creates and configures the HTTP mux with all routes
 func (s *Server) BuildCommonHandler() *http.Handler {
 	mux := http.NewServeMux()
 
-	// Create handlers with dependencies
-	h := NewHandlers(s.deps)
+	// Register routes from the route table
+	routes := s.Routes()
+	s.registerRoutes(mux, routes)
 
-	// Register routes
-	mux.HandleFunc("/ping", h.Ping)
-	mux.HandleFunc("/signup", h.SignUp)
-	mux.HandleFunc("/user", h.User)
+	// Serve OpenAPI document describing the route table
+	var docRoutes []Route
+	specHandler, err := openAPIHandler(BuildOpenAPI(routes))
+	if err != nil {
+		s.deps.Log.Error("internal.server.server.BuildCommonHandler", "error", err)
+	} else {
+		docRoutes = append(docRoutes, Route{
+			Name: "openapi", Method: http.MethodGet, Path: OpenAPIPath,
+			Handler: specHandler,
+			CORS:    PublicCORSPolicy,
+		})
+		if s.deps.Cfg.OpenAPIViewer {
+			// Viewer page loads Swagger UI assets from CDN
+			docRoutes = append(docRoutes, Route{
+				Name: "docs", Method: http.MethodGet, Path: "/docs",
+				Handler: openapi.ViewerHandler(OpenAPIPath),
+				SecurityHeaders: map[string]string{
+					"Content-Security-Policy": "default-src 'none'; script-src https://unpkg.com 'unsafe-inline'; " +
+						"style-src https://unpkg.com 'unsafe-inline'; img-src 'self' data: https://unpkg.com; " +
+						"connect-src 'self'; frame-ancestors 'none'",
+				},
+			})
+		}
+		s.registerRoutes(mux, docRoutes)
+	}
 
-	commonHandler := s.corsMiddleware(mux)
+	commonHandler := s.corsMiddleware(mux, s.newCORSPolicies(append(routes, docRoutes...)), mux)
+	commonHandler = s.securityHeadersMiddleware(commonHandler)
 	commonHandler = s.panicMiddleware(commonHandler)
+	commonHandler = s.requestMiddleware(commonHandler)
+	commonHandler = s.metricsMiddleware(mux, commonHandler)
+	commonHandler = s.tracingMiddleware(mux, commonHandler)
 
 	return &commonHandler
 }
+
+// NewHTTPServer creates HTTP server with timeouts and header size limit from configuration
+func NewHTTPServer(addr string, handler http.Handler, cfg types.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// BuildAdminHandler creates the HTTP mux for the separate admin listener
+func (s *Server) BuildAdminHandler() *http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	adminHandler := s.panicMiddleware(mux)
+
+	return &adminHandler
+}
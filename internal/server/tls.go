@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// serviceUserIdPrefix distinguishes service identities from user IDs in
+// access logs and audit events
+const serviceUserIdPrefix = "service:"
+
+// serviceIdentity returns identity of verified client certificate, it is the
+// first URI SAN like spiffe://example.org/billing or subject common name
+func serviceIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
+
+// serviceUser authenticates request by client certificate of a configured
+// service identity
+func (s *Server) serviceUser(r *http.Request) (iam.User, bool) {
+	identity := serviceIdentity(r)
+	if identity == "" || !s.deps.Cfg.TLS.ServiceIdentities[identity] {
+		return iam.User{}, false
+	}
+
+	return iam.User{
+		Id:       serviceUserIdPrefix + identity,
+		Username: identity,
+		IsAdmin:  s.deps.Cfg.TLS.AdminIdentities[identity],
+	}, true
+}
+
+// RedirectHandler redirects plain HTTP requests to HTTPS listener on httpsPort
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// IPv6 literal without port, e.g. [::1]
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		switch {
+		case httpsPort != "443":
+			host = net.JoinHostPort(host, httpsPort)
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		// Permanent redirect of GET and HEAD only, other methods keep their body with 308
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target, status)
+	})
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// serviceTLS returns connection state of a verified client certificate with
+// the common name
+func serviceTLS(commonName string, uris ...string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil {
+			panic(err)
+		}
+		cert.URIs = append(cert.URIs, u)
+	}
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
+
+func TestServiceIdentity(t *testing.T) {
+	unverified := serviceTLS("billing")
+	unverified.VerifiedChains = nil
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		want  string
+	}{
+		{"plain HTTP", nil, ""},
+		{"no client certificate", &tls.ConnectionState{}, ""},
+		{"unverified certificate", unverified, ""},
+		{"common name", serviceTLS("billing"), "billing"},
+		{"first URI SAN", serviceTLS("billing", "spiffe://example.org/billing", "spiffe://example.org/other"), "spiffe://example.org/billing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/user", nil)
+			r.TLS = tt.state
+			if got := serviceIdentity(r); got != tt.want {
+				t.Errorf("serviceIdentity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceUser(t *testing.T) {
+	s := &Server{deps: Dependencies{Cfg: types.ServerConfig{TLS: types.TLSConfig{
+		ServiceIdentities: map[string]bool{"billing": true, "spiffe://example.org/ops": true},
+		AdminIdentities:   map[string]bool{"spiffe://example.org/ops": true},
+	}}}}
+
+	tests := []struct {
+		name    string
+		state   *tls.ConnectionState
+		ok      bool
+		id      string
+		isAdmin bool
+	}{
+		{"service", serviceTLS("billing"), true, "service:billing", false},
+		{"admin service", serviceTLS("ops", "spiffe://example.org/ops"), true, "service:spiffe://example.org/ops", true},
+		{"unknown identity", serviceTLS("reports"), false, "", false},
+		{"no certificate", nil, false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/user", nil)
+			r.TLS = tt.state
+
+			user, ok := s.serviceUser(r)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if user.Id != tt.id || user.IsAdmin != tt.isAdmin {
+				t.Errorf("user = %s admin %v, want %s admin %v", user.Id, user.IsAdmin, tt.id, tt.isAdmin)
+			}
+		})
+	}
+}
+
+// TestServiceAuthentication checks that services reach authenticated routes
+// without a token and get administrator access only if configured
+func TestServiceAuthentication(t *testing.T) {
+	_, handler := newSpecServer(t, newSpecDB(t), func(deps *Dependencies) {
+		deps.Cfg.TLS.ServiceIdentities = map[string]bool{"billing": true, "ops": true}
+		deps.Cfg.TLS.AdminIdentities = map[string]bool{"ops": true}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		state  *tls.ConnectionState
+		status int
+	}{
+		{"service", "/v1/user", serviceTLS("billing"), http.StatusOK},
+		{"unknown service", "/v1/user", serviceTLS("reports"), http.StatusUnauthorized},
+		{"service without admin access", "/v1/admin/audit", serviceTLS("billing"), http.StatusForbidden},
+		{"admin service", "/v1/admin/audit", serviceTLS("ops"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.TLS = tt.state
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d, body: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   string
+		method string
+		host   string
+		target string
+		status int
+	}{
+		{"host", "8443", http.MethodGet, "example.com", "https://example.com:8443/v1/user?a=b", http.StatusMovedPermanently},
+		{"host with port", "8443", http.MethodGet, "example.com:8080", "https://example.com:8443/v1/user?a=b", http.StatusMovedPermanently},
+		{"default HTTPS port", "443", http.MethodGet, "example.com:80", "https://example.com/v1/user?a=b", http.StatusMovedPermanently},
+		{"IPv4", "8443", http.MethodHead, "127.0.0.1:80", "https://127.0.0.1:8443/v1/user?a=b", http.StatusMovedPermanently},
+		{"IPv6 with port", "8443", http.MethodGet, "[::1]:80", "https://[::1]:8443/v1/user?a=b", http.StatusMovedPermanently},
+		{"IPv6 without port", "8443", http.MethodGet, "[::1]", "https://[::1]:8443/v1/user?a=b", http.StatusMovedPermanently},
+		{"IPv6 default HTTPS port", "443", http.MethodGet, "[::1]", "https://[::1]/v1/user?a=b", http.StatusMovedPermanently},
+		{"body keeping method", "8443", http.MethodPost, "example.com", "https://example.com:8443/v1/user?a=b", http.StatusPermanentRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/user?a=b", nil)
+			r.Host = tt.host
+			rec := httptest.NewRecorder()
+			RedirectHandler(tt.port).ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Location"); got != tt.target {
+				t.Errorf("Location = %s, want %s", got, tt.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// auditVerifyPageSize is a number of events fetched per page during chain verification
+const auditVerifyPageSize = 500
+
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// RecordAuditEvent appends a new event to the tamper-evident audit log
+func RecordAuditEvent(ctx context.Context, tx db.Tx, event iam.AuditEvent) (iam.AuditEvent, error) {
+	if event.Action == "" {
+		return event, fmt.Errorf("audit event action is required")
+	}
+	if event.Result == "" {
+		event.Result = iam.AuditResultSuccess
+	}
+
+	event, err := tx.CreateAuditEvent(ctx, event)
+	if err != nil {
+		return event, fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return event, nil
+}
+
+// VerifyAuditChain walks through the whole audit log and checks every event
+// hash and its link to the previous event, returns number of verified events
+func VerifyAuditChain(ctx context.Context, database db.Database) (int, error) {
+	var (
+		prevHash string
+		afterId  int64
+		verified int
+	)
+
+	for {
+		events, err := database.ListAuditEvents(ctx, db.AuditEventFilter{AfterId: afterId, Limit: auditVerifyPageSize})
+		if err != nil {
+			return verified, fmt.Errorf("failed to list audit events: %w", err)
+		}
+
+		for _, e := range events {
+			if e.PrevHash != prevHash {
+				return verified, fmt.Errorf("%w: event %d does not link to the previous event", ErrAuditChainBroken, e.Id)
+			}
+			if e.ComputeHash() != e.Hash {
+				return verified, fmt.Errorf("%w: event %d content does not match its hash", ErrAuditChainBroken, e.Id)
+			}
+
+			prevHash = e.Hash
+			afterId = e.Id
+			verified++
+		}
+
+		if len(events) < auditVerifyPageSize {
+			return verified, nil
+		}
+	}
+}
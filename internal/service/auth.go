@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+var (
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrTokenExpired = errors.New("token expired")
+	ErrUserDisabled = errors.New("user disabled")
+)
+
+// Authenticate resolves the user owning an active token, lookups run on the
+// primary, so revoked tokens and disabled users are rejected without
+// replication lag
+func Authenticate(ctx context.Context, database db.Database, tokenId string) (iam.User, error) {
+	ctx = db.WithPrimary(ctx)
+
+	token, err := database.GetToken(ctx, tokenId)
+	if err != nil {
+		return iam.User{}, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	if token.IsRevoked {
+		return iam.User{}, ErrTokenRevoked
+	}
+	if !token.ExpiresAt.IsZero() && time.Now().After(token.ExpiresAt) {
+		return iam.User{}, ErrTokenExpired
+	}
+
+	user, err := database.GetUser(ctx, token.UserId, "")
+	if err != nil {
+		return iam.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.IsDisabled {
+		return iam.User{}, ErrUserDisabled
+	}
+
+	return user, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/tracing"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Login verifies user credentials and issues a new token valid for ttl
+func Login(ctx context.Context, database db.Database, username, password string, ttl time.Duration) (user iam.User, token iam.Token, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.Login")
+	defer func() { tracing.End(span, err) }()
+
+	// Replicas may lag behind password changes and disabled accounts
+	user, err = database.GetUser(db.WithPrimary(ctx), "", username)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			// Spend the same time as for existing user to not reveal usernames
+			verifyPassword(ctx, dummyPasswordHash, password)
+			return iam.User{}, iam.Token{}, ErrInvalidCredentials
+		}
+		return iam.User{}, iam.Token{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	ok, err := verifyPassword(ctx, user.PasswordHash, password)
+	if err != nil {
+		return iam.User{}, iam.Token{}, fmt.Errorf("failed to verify password: %w", err)
+	}
+	if !ok {
+		return user, iam.Token{}, ErrInvalidCredentials
+	}
+	if user.IsDisabled {
+		return user, iam.Token{}, ErrUserDisabled
+	}
+
+	token, err = database.CreateToken(ctx, user.Id, time.Now().Add(ttl))
+	if err != nil {
+		return user, iam.Token{}, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return user, token, nil
+}
+
+// RefreshToken atomically rotates active token, the new one is valid for ttl and the old one is revoked
+func RefreshToken(ctx context.Context, database db.Database, user iam.User, tokenId string, ttl time.Duration) (token iam.Token, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.RefreshToken")
+	defer func() { tracing.End(span, err) }()
+
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		token, err = tx.CreateToken(ctx, user.Id, time.Now().Add(ttl))
+		if err != nil {
+			return fmt.Errorf("failed to create token: %w", err)
+		}
+
+		if err := tx.RevokeToken(ctx, tokenId); err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return iam.Token{}, err
+	}
+
+	return token, nil
+}
+
+// Logout revokes the token
+func Logout(ctx context.Context, database db.Database, tokenId string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.Logout")
+	defer func() { tracing.End(span, err) }()
+
+	if err := database.RevokeToken(ctx, tokenId); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
@@ -3,9 +3,18 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/kompotkot/tripidium/internal/metrics"
+	"github.com/kompotkot/tripidium/internal/tracing"
+	"github.com/kompotkot/tripidium/internal/types"
 	"github.com/kompotkot/tripidium/pkg/db"
 	"github.com/kompotkot/tripidium/pkg/iam"
 
@@ -21,8 +30,14 @@ const (
 	saltLen      int    = 16
 )
 
+// dummyPasswordHash is verified against when user does not exist to keep timing uniform
+const dummyPasswordHash = "AAAAAAAAAAAAAAAAAAAAAA$AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
 // hashPassword securely hashes a password using Argon2 algorithm
-func hashPassword(password string) (string, error) {
+func hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Tracer().Start(ctx, "service.hashPassword")
+	defer span.End()
+
 	// Generate a random salt for password hashing
 	salt := make([]byte, saltLen)
 	_, err := rand.Read(salt)
@@ -31,7 +46,9 @@ func hashPassword(password string) (string, error) {
 	}
 
 	// Hash the password using Argon2id with the generated salt
+	start := time.Now()
 	hash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	metrics.PasswordHashDuration.Observe(time.Since(start).Seconds())
 
 	// Encode salt and hash to base64 for storage
 	encodedSalt := base64.RawStdEncoding.EncodeToString(salt)
@@ -41,21 +58,120 @@ func hashPassword(password string) (string, error) {
 	return fmt.Sprintf("%s$%s", encodedSalt, encodedHash), nil
 }
 
-// SignUp creates a new user account with the provided username and password
-func SignUp(ctx context.Context, db db.Database, username, password string) (iam.User, error) {
-	var user iam.User
+// verifyPassword checks password against "salt$hash" encoded Argon2 hash in constant time
+func verifyPassword(ctx context.Context, passwordHash, password string) (bool, error) {
+	_, span := tracing.Tracer().Start(ctx, "service.verifyPassword")
+	defer span.End()
+
+	encodedSalt, encodedHash, ok := strings.Cut(passwordHash, "$")
+	if !ok {
+		return false, fmt.Errorf("malformed password hash")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode salt: %w", err)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(encodedHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode hash: %w", err)
+	}
+
+	start := time.Now()
+	hash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, uint32(len(expected)))
+	metrics.PasswordHashDuration.Observe(time.Since(start).Seconds())
+
+	return subtle.ConstantTimeCompare(hash, expected) == 1, nil
+}
+
+// SignUp creates a new user account with the provided username and password.
+// The user is created in a transaction together with writes of fn, e.g. audit
+// event, fn may be nil. Password is hashed before the transaction starts.
+func SignUp(ctx context.Context, database db.Database, username, password string, fn func(tx db.Tx, user iam.User) error) (user iam.User, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.SignUp")
+	defer func() { tracing.End(span, err) }()
 
 	// TODO(kompotkot): Add username and password validation
 
-	passwordHash, err := hashPassword(password)
+	passwordHash, err := hashPassword(ctx, password)
 	if err != nil {
 		return user, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	user, err = db.CreateUser(ctx, username, passwordHash)
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		user, err = tx.CreateUser(ctx, username, passwordHash)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		if fn != nil {
+			return fn(tx, user)
+		}
+		return nil
+	})
 	if err != nil {
-		return user, fmt.Errorf("failed to create user: %w", err)
+		return iam.User{}, err
 	}
 
 	return user, nil
 }
+
+// SetPassword replaces password of the user in a transaction together with
+// writes of fn, e.g. token revocation and audit event, fn may be nil
+func SetPassword(ctx context.Context, database db.Database, userId, password string, fn func(tx db.Tx, user iam.User) error) (user iam.User, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "service.SetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	passwordHash, err := hashPassword(ctx, password)
+	if err != nil {
+		return user, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		user, err = tx.UpdateUser(ctx, userId, db.UserUpdate{PasswordHash: &passwordHash})
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if fn != nil {
+			return fn(tx, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// CheckPassword returns description of the first policy rule the password violates
+func CheckPassword(policy types.PasswordPolicy, password string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("must be at least %d characters", policy.MinLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	switch {
+	case policy.RequireUpper && !upper:
+		return errors.New("must contain an uppercase letter")
+	case policy.RequireLower && !lower:
+		return errors.New("must contain a lowercase letter")
+	case policy.RequireDigit && !digit:
+		return errors.New("must contain a digit")
+	case policy.RequireSymbol && !symbol:
+		return errors.New("must contain a symbol")
+	}
+	return nil
+}
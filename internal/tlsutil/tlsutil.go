@@ -0,0 +1,198 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// Client certificate verification modes
+const (
+	ClientAuthNone          = "none"
+	ClientAuthRequest       = "request"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+	ClientAuthRequire       = "require"
+)
+
+// ClientAuthType converts client authentication mode to tls.ClientAuthType
+func ClientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode: %s", mode)
+	}
+}
+
+// fileStamp identifies file version by modification time and size
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader keeps server certificate and client CA bundle loaded from files
+// and replaces them without restart when the files change
+type Reloader struct {
+	cfg        types.TLSConfig
+	log        *slog.Logger
+	clientAuth tls.ClientAuthType
+
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+}
+
+// NewReloader loads certificate files, failure to load them is fatal
+func NewReloader(cfg types.TLSConfig, log *slog.Logger) (*Reloader, error) {
+	clientAuth, err := ClientAuthType(cfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAFile == "" {
+		return nil, errors.New("client CA file is required to verify client certificates")
+	}
+
+	r := &Reloader{
+		cfg:        cfg,
+		log:        log,
+		clientAuth: clientAuth,
+		stamps:     map[string]fileStamp{},
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// files returns paths of watched files
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// Reload loads all files and swaps them in, on error previous ones stay in use
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamps := map[string]fileStamp{}
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", f, err)
+		}
+		stamps[f] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	r.stamps = stamps
+
+	return nil
+}
+
+// changed reports whether any watched file differs from the loaded version
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			// File may be in the middle of replacement, check on the next tick
+			continue
+		}
+		if stamp := r.stamps[f]; !info.ModTime().Equal(stamp.modTime) || info.Size() != stamp.size {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls files with configured interval and reloads them on change
+// until ctx is cancelled, it is a lifecycle worker
+func (r *Reloader) Watch(ctx context.Context) error {
+	if r.cfg.ReloadInterval <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.log.Error("Failed to reload TLS certificates, keeping previous ones", "error", err)
+				continue
+			}
+			r.log.Info("TLS certificates reloaded", "cert_file", r.cfg.CertFile)
+		}
+	}
+}
+
+// TLSConfig returns server configuration resolving certificate and client CAs
+// on every handshake, so reloaded files apply to new connections
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion:   r.cfg.MinVersion,
+		CipherSuites: r.cfg.CipherSuites,
+		ClientAuth:   r.clientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	cfg := base.Clone()
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return r.cert.Load(), nil
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*r.cert.Load()}
+		c.ClientCAs = r.clientCAs.Load()
+		return c, nil
+	}
+	return cfg
+}
@@ -0,0 +1,240 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/types"
+)
+
+// writeCert writes self-signed certificate with the common name and its key
+// to cert.pem and key.pem in dir
+func writeCert(t *testing.T, dir, commonName string) types.TLSConfig {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+
+	cfg := types.TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	writeFile(t, cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return cfg
+}
+
+// writeFile writes data and moves modification time forward, so changes are
+// detected on file systems with coarse timestamps
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	var modTime time.Time
+	if info, err := os.Stat(name); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+}
+
+// commonName returns common name of the certificate served by the reloader
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cert := r.cert.Load()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestClientAuthType(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{"", tls.NoClientCert, false},
+		{ClientAuthNone, tls.NoClientCert, false},
+		{ClientAuthRequest, tls.RequestClientCert, false},
+		{ClientAuthVerifyIfGiven, tls.VerifyClientCertIfGiven, false},
+		{ClientAuthRequire, tls.RequireAndVerifyClientCert, false},
+		{"always", tls.NoClientCert, true},
+	}
+	for _, tt := range tests {
+		got, err := ClientAuthType(tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ClientAuthType(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ClientAuthType(%q) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestNewReloader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := writeCert(t, dir, "server")
+
+	emptyCA := filepath.Join(dir, "empty-ca.pem")
+	writeFile(t, emptyCA, []byte("no certificates here"))
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *types.TLSConfig)
+		wantErr bool
+	}{
+		{"certificate", func(cfg *types.TLSConfig) {}, false},
+		{"client CA", func(cfg *types.TLSConfig) {
+			cfg.ClientAuth = ClientAuthRequire
+			cfg.ClientCAFile = cfg.CertFile
+		}, false},
+		{"unknown client auth mode", func(cfg *types.TLSConfig) { cfg.ClientAuth = "always" }, true},
+		{"verification without client CA", func(cfg *types.TLSConfig) { cfg.ClientAuth = ClientAuthVerifyIfGiven }, true},
+		{"client CA without certificates", func(cfg *types.TLSConfig) {
+			cfg.ClientAuth = ClientAuthRequire
+			cfg.ClientCAFile = emptyCA
+		}, true},
+		{"missing key", func(cfg *types.TLSConfig) { cfg.KeyFile = filepath.Join(dir, "missing.pem") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			tt.modify(&c)
+			r, err := NewReloader(c, slog.New(slog.DiscardHandler))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewReloader error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && commonName(t, r) != "server" {
+				t.Errorf("common name = %s, want server", commonName(t, r))
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	cfg := writeCert(t, dir, "first")
+
+	r, err := NewReloader(cfg, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	if r.changed() {
+		t.Fatal("changed = true right after loading")
+	}
+
+	writeCert(t, dir, "second")
+	if !r.changed() {
+		t.Fatal("changed = false after files were replaced")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := commonName(t, r); got != "second" {
+		t.Errorf("common name = %s, want second", got)
+	}
+	if r.changed() {
+		t.Error("changed = true after reload")
+	}
+
+	// Broken certificate keeps the previous one in use
+	writeFile(t, cfg.CertFile, []byte("broken"))
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload of broken certificate succeeded")
+	}
+	if got := commonName(t, r); got != "second" {
+		t.Errorf("common name = %s after failed reload, want second", got)
+	}
+	if !r.changed() {
+		t.Error("changed = false after failed reload, fixed files would not be retried")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	cfg := writeCert(t, dir, "first")
+	cfg.ReloadInterval = 10 * time.Millisecond
+
+	r, err := NewReloader(cfg, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Watch(ctx) }()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = r.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if got := served(); got != "first" {
+		t.Fatalf("served common name = %s, want first", got)
+	}
+
+	writeCert(t, dir, "second")
+	deadline := time.Now().Add(5 * time.Second)
+	for served() != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("reloaded certificate is not served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDatabase decorates Database with a span per call
+type tracedDatabase struct {
+	tracedTx
+	next db.Database
+}
+
+// tracedTx decorates data operations with a span per call
+type tracedTx struct {
+	next   db.Tx
+	dbType string
+}
+
+// WrapDatabase returns Database creating a child span for every call, the
+// result implements db.StatsProvider and db.Snapshotter if database does
+func WrapDatabase(database db.Database, dbType string) db.Database {
+	traced := &tracedDatabase{
+		tracedTx: tracedTx{next: database, dbType: dbType},
+		next:     database,
+	}
+
+	stats, hasStats := database.(db.StatsProvider)
+	snapshotter, hasSnapshotter := database.(db.Snapshotter)
+	switch {
+	case hasStats && hasSnapshotter:
+		return struct {
+			*tracedDatabase
+			db.StatsProvider
+			db.Snapshotter
+		}{traced, stats, snapshotter}
+	case hasStats:
+		return struct {
+			*tracedDatabase
+			db.StatsProvider
+		}{traced, stats}
+	case hasSnapshotter:
+		return struct {
+			*tracedDatabase
+			db.Snapshotter
+		}{traced, snapshotter}
+	}
+	return traced
+}
+
+// start opens client span for the database operation
+func (d *tracedTx) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "db."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", d.dbType),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+func (d *tracedDatabase) TestConnection(ctx context.Context) error {
+	ctx, span := d.start(ctx, "TestConnection")
+	err := d.next.TestConnection(ctx)
+	End(span, err)
+	return err
+}
+
+func (d *tracedDatabase) Close() error {
+	return d.next.Close()
+}
+
+func (d *tracedDatabase) Migrate(ctx context.Context) error {
+	ctx, span := d.start(ctx, "Migrate")
+	err := d.next.Migrate(ctx)
+	End(span, err)
+	return err
+}
+
+func (d *tracedDatabase) SchemaVersion(ctx context.Context) (int, int, error) {
+	ctx, span := d.start(ctx, "SchemaVersion")
+	current, latest, err := d.next.SchemaVersion(ctx)
+	End(span, err)
+	return current, latest, err
+}
+
+func (d *tracedDatabase) Rollback(ctx context.Context, version int) error {
+	ctx, span := d.start(ctx, "Rollback")
+	err := d.next.Rollback(ctx, version)
+	End(span, err)
+	return err
+}
+
+func (d *tracedDatabase) Migrations() []db.Migration {
+	return d.next.Migrations()
+}
+
+// WithTx spans the whole transaction including retries
+func (d *tracedDatabase) WithTx(ctx context.Context, fn func(tx db.Tx) error, opts ...db.TxOption) error {
+	ctx, span := d.start(ctx, "WithTx")
+	err := d.next.WithTx(ctx, func(tx db.Tx) error {
+		return fn(&tracedTx{next: tx, dbType: d.dbType})
+	}, opts...)
+	End(span, err)
+	return err
+}
+
+func (d *tracedTx) CreateUser(ctx context.Context, username string, passwordHash string) (iam.User, error) {
+	ctx, span := d.start(ctx, "CreateUser")
+	user, err := d.next.CreateUser(ctx, username, passwordHash)
+	End(span, err)
+	return user, err
+}
+
+func (d *tracedTx) GetUser(ctx context.Context, userId, username string) (iam.User, error) {
+	ctx, span := d.start(ctx, "GetUser")
+	user, err := d.next.GetUser(ctx, userId, username)
+	End(span, err)
+	return user, err
+}
+
+func (d *tracedTx) ListUsers(ctx context.Context) ([]iam.User, error) {
+	ctx, span := d.start(ctx, "ListUsers")
+	users, err := d.next.ListUsers(ctx)
+	End(span, err)
+	return users, err
+}
+
+func (d *tracedTx) UpdateUser(ctx context.Context, userId string, update db.UserUpdate) (iam.User, error) {
+	ctx, span := d.start(ctx, "UpdateUser")
+	user, err := d.next.UpdateUser(ctx, userId, update)
+	End(span, err)
+	return user, err
+}
+
+func (d *tracedTx) GetToken(ctx context.Context, tokenId string) (iam.Token, error) {
+	ctx, span := d.start(ctx, "GetToken")
+	token, err := d.next.GetToken(ctx, tokenId)
+	End(span, err)
+	return token, err
+}
+
+func (d *tracedTx) CreateToken(ctx context.Context, userId string, expiresAt time.Time) (iam.Token, error) {
+	ctx, span := d.start(ctx, "CreateToken")
+	token, err := d.next.CreateToken(ctx, userId, expiresAt)
+	End(span, err)
+	return token, err
+}
+
+func (d *tracedTx) RevokeToken(ctx context.Context, tokenId string) error {
+	ctx, span := d.start(ctx, "RevokeToken")
+	err := d.next.RevokeToken(ctx, tokenId)
+	End(span, err)
+	return err
+}
+
+func (d *tracedTx) ListTokens(ctx context.Context, userId string) ([]iam.Token, error) {
+	ctx, span := d.start(ctx, "ListTokens")
+	tokens, err := d.next.ListTokens(ctx, userId)
+	End(span, err)
+	return tokens, err
+}
+
+func (d *tracedTx) CreateAuditEvent(ctx context.Context, event iam.AuditEvent) (iam.AuditEvent, error) {
+	ctx, span := d.start(ctx, "CreateAuditEvent")
+	event, err := d.next.CreateAuditEvent(ctx, event)
+	End(span, err)
+	return event, err
+}
+
+func (d *tracedTx) ListAuditEvents(ctx context.Context, filter db.AuditEventFilter) ([]iam.AuditEvent, error) {
+	ctx, span := d.start(ctx, "ListAuditEvents")
+	events, err := d.next.ListAuditEvents(ctx, filter)
+	End(span, err)
+	return events, err
+}
+
+func (d *tracedTx) UpdateRateLimit(ctx context.Context, key string, update func(tat time.Time) time.Time) error {
+	ctx, span := d.start(ctx, "UpdateRateLimit")
+	err := d.next.UpdateRateLimit(ctx, key, update)
+	End(span, err)
+	return err
+}
+
+func (d *tracedTx) DeleteRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := d.start(ctx, "DeleteRateLimits")
+	n, err := d.next.DeleteRateLimits(ctx, before)
+	End(span, err)
+	return n, err
+}
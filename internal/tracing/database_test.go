@@ -0,0 +1,174 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kompotkot/tripidium/internal/tracing"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/db/memory"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// plainDB hides optional interfaces of the wrapped database
+type plainDB struct {
+	db.Database
+}
+
+// statsDB is a database providing connection pool statistics
+type statsDB struct {
+	db.Database
+}
+
+func (statsDB) Stats() db.PoolStats {
+	return db.PoolStats{MaxConns: 7}
+}
+
+// newExporter installs global tracer provider recording spans in memory
+func newExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		tp.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func newMemoryDB(t *testing.T) *memory.MemoryDB {
+	database, err := memory.NewMemoryDB("")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return database
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestWrapDatabaseSpans(t *testing.T) {
+	exporter := newExporter(t)
+	database := tracing.WrapDatabase(newMemoryDB(t), "memory")
+	ctx := context.Background()
+
+	user, err := database.CreateUser(ctx, "alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := database.GetUser(ctx, "", "alice"); err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	_, err = database.GetUser(ctx, "", "bob")
+	if !errors.Is(err, db.ErrUserNotFound) {
+		t.Fatalf("GetUser error = %v, want %v", err, db.ErrUserNotFound)
+	}
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		_, err := tx.ListTokens(ctx, user.Id)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	want := []struct {
+		name string
+		code codes.Code
+	}{
+		{"db.CreateUser", codes.Unset},
+		{"db.GetUser", codes.Unset},
+		{"db.GetUser", codes.Error},
+		// Spans end in reverse order of start
+		{"db.ListTokens", codes.Unset},
+		{"db.WithTx", codes.Unset},
+	}
+	if len(spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(spans), len(want))
+	}
+	for i, w := range want {
+		span := spans[i]
+		if span.Name != w.name {
+			t.Errorf("span %d name = %q, want %q", i, span.Name, w.name)
+		}
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("%s kind = %v, want %v", span.Name, span.SpanKind, trace.SpanKindClient)
+		}
+		if span.Status.Code != w.code {
+			t.Errorf("%s status = %v, want %v", span.Name, span.Status.Code, w.code)
+		}
+		attrs := attributes(span)
+		if attrs["db.system"] != "memory" {
+			t.Errorf("%s db.system = %q, want %q", span.Name, attrs["db.system"], "memory")
+		}
+		if op := span.Name[len("db."):]; attrs["db.operation"] != op {
+			t.Errorf("%s db.operation = %q, want %q", span.Name, attrs["db.operation"], op)
+		}
+	}
+
+	failed := spans[2]
+	if failed.Status.Description != db.ErrUserNotFound.Error() {
+		t.Errorf("status description = %q, want %q", failed.Status.Description, db.ErrUserNotFound.Error())
+	}
+	if len(failed.Events) != 1 || failed.Events[0].Name != "exception" {
+		t.Errorf("events = %v, want recorded error", failed.Events)
+	}
+}
+
+func TestWrapDatabaseOptionalInterfaces(t *testing.T) {
+	tests := []struct {
+		name        string
+		database    db.Database
+		stats       bool
+		snapshotter bool
+	}{
+		{"none", plainDB{newMemoryDB(t)}, false, false},
+		{"stats", statsDB{plainDB{newMemoryDB(t)}}, true, false},
+		{"snapshotter", newMemoryDB(t), false, true},
+		{"stats and snapshotter", struct {
+			statsDB
+			db.Snapshotter
+		}{statsDB{newMemoryDB(t)}, newMemoryDB(t)}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := tracing.WrapDatabase(tt.database, "memory")
+
+			stats, ok := wrapped.(db.StatsProvider)
+			if ok != tt.stats {
+				t.Fatalf("StatsProvider = %v, want %v", ok, tt.stats)
+			}
+			if ok && stats.Stats().MaxConns != 7 {
+				t.Errorf("Stats().MaxConns = %d, want 7", stats.Stats().MaxConns)
+			}
+
+			snapshotter, ok := wrapped.(db.Snapshotter)
+			if ok != tt.snapshotter {
+				t.Fatalf("Snapshotter = %v, want %v", ok, tt.snapshotter)
+			}
+			if ok {
+				if err := snapshotter.Snapshot(); err != nil {
+					t.Errorf("Snapshot: %v", err)
+				}
+			}
+		})
+	}
+}
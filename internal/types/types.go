@@ -1,32 +1,150 @@
 package types
 
-import "time"
+import (
+	"net/netip"
+	"time"
+)
+
+// Configuration structs are loaded by internal/config. The env tag names the
+// variable relative to the prefix of the enclosing section, options are
+// secret to redact the value in dumps and allowempty to let an empty value
+// override the default. Durations of _SEC variables are given in seconds.
 
 // Logger configuration
 type LoggerConfig struct {
-	Level  string
-	Format string
+	Level  string `env:"LEVEL" validate:"oneof=debug info warn error"`
+	Format string `env:"FORMAT" validate:"oneof=text json"`
 }
 
 // Database configuration
 type DatabaseConfig struct {
-	Type            string
-	URI             string
-	MaxConns        int
-	ConnMaxLifetime time.Duration
+	Type            string        `env:"TYPE" validate:"required"`
+	URI             string        `env:"URI,secret"`
+	MaxConns        int           `env:"MAX_OPEN_CONNS" validate:"min=1"`
+	ConnMaxLifetime time.Duration `env:"CONN_MAX_LIFETIME_SEC" validate:"min=0"`
+	ConnMaxIdleTime time.Duration `env:"CONN_MAX_IDLE_TIME_SEC" validate:"min=0"`
+
+	MinConns          int           `env:"MIN_CONNS" validate:"min=0"`
+	HealthCheckPeriod time.Duration `env:"HEALTH_CHECK_PERIOD_SEC" validate:"min=0"`
+	ConnectTimeout    time.Duration `env:"CONNECT_TIMEOUT_SEC" validate:"min=0"`
+	StatementTimeout  time.Duration `env:"STATEMENT_TIMEOUT_SEC" validate:"min=0"`
+	ApplicationName   string        `env:"APPLICATION_NAME"`
+
+	ReplicaURIs        []string      `env:"REPLICA_URIS,secret"`
+	ReplicaCheckPeriod time.Duration `env:"REPLICA_CHECK_PERIOD_SEC" validate:"min=0"`
+
+	Sqlite SqliteConfig `env:"SQLITE_"`
+	Memory MemoryConfig `env:"MEMORY_"`
+}
+
+// SQLite configuration
+type SqliteConfig struct {
+	WAL         bool          `env:"WAL"`
+	Synchronous string        `env:"SYNCHRONOUS" validate:"oneof=OFF NORMAL FULL EXTRA"`
+	BusyTimeout time.Duration `env:"BUSY_TIMEOUT_SEC" validate:"min=0"`
+	CacheSize   int           `env:"CACHE_SIZE"`
+	MmapSize    int64         `env:"MMAP_SIZE" validate:"min=0"`
+	ReadOnly    bool          `env:"READ_ONLY"`
+}
+
+// Memory database configuration
+type MemoryConfig struct {
+	SnapshotInterval time.Duration `env:"SNAPSHOT_INTERVAL_SEC" validate:"min=0"`
 }
 
 // Server configuration
 type ServerConfig struct {
-	Addr                      string
-	Port                      string
-	CORSWhitelist             map[string]bool
-	CORSAllowedDefaultMethods string
+	Addr                      string          `env:"ADDR"`
+	Port                      string          `env:"PORT" validate:"port"`
+	CORSWhitelist             map[string]bool `env:"CORS_WHITELIST" parse:"origins"`
+	CORSAllowedDefaultMethods string          `env:"CORS_ALLOWED_DEFAULT_METHODS"`
+	CORSAllowedHeaders        []string        `env:"CORS_ALLOWED_HEADERS,allowempty"`
+	CORSExposedHeaders        []string        `env:"CORS_EXPOSED_HEADERS,allowempty"`
+	CORSAllowCredentials      bool            `env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge                time.Duration   `env:"CORS_MAX_AGE_SEC" validate:"min=0"`
+	AdminAddr                 string          `env:"ADMIN_ADDR"`
+	AdminPort                 string          `env:"ADMIN_PORT" validate:"port"`
+	TrustedProxies            []netip.Prefix  `env:"TRUSTED_PROXIES" parse:"prefixes"`
+	HealthCheckTimeout        time.Duration   `env:"HEALTH_CHECK_TIMEOUT_SEC" validate:"min=1"`
+	HealthCacheTTL            time.Duration   `env:"HEALTH_CACHE_TTL_SEC" validate:"min=0"`
+	ShutdownTimeout           time.Duration   `env:"SHUTDOWN_TIMEOUT_SEC" validate:"min=1"`
+	ShutdownDelay             time.Duration   `env:"SHUTDOWN_DELAY_SEC" validate:"min=0"`
+	OpenAPIViewer             bool            `env:"OPENAPI_VIEWER"`
+	TokenTTL                  time.Duration   `env:"TOKEN_TTL_SEC" validate:"min=1"`
+	TLS                       TLSConfig       `env:"TLS_"`
+
+	ReadHeaderTimeout time.Duration `env:"READ_HEADER_TIMEOUT_SEC" validate:"min=1"`
+	ReadTimeout       time.Duration `env:"READ_TIMEOUT_SEC" validate:"min=0"`
+	WriteTimeout      time.Duration `env:"WRITE_TIMEOUT_SEC" validate:"min=0"`
+	IdleTimeout       time.Duration `env:"IDLE_TIMEOUT_SEC" validate:"min=0"`
+	MaxHeaderBytes    int           `env:"MAX_HEADER_BYTES" validate:"min=1024"`
+	// MaxBodyBytes limits request bodies of routes without own limit
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES" validate:"min=1"`
+
+	// Default security headers, routes may override them
+	HSTSMaxAge            time.Duration `env:"HSTS_MAX_AGE_SEC" validate:"min=0"`
+	ContentSecurityPolicy string        `env:"CONTENT_SECURITY_POLICY,allowempty"`
+	ReferrerPolicy        string        `env:"REFERRER_POLICY,allowempty"`
+	FrameOptions          string        `env:"FRAME_OPTIONS,allowempty" validate:"oneof=DENY SAMEORIGIN"`
+
+	// RateLimitStore is memory or database
+	RateLimitStore string      `env:"RATE_LIMIT_STORE" validate:"oneof=memory database"`
+	RateLimits     []RateLimit `env:"RATE_LIMITS,allowempty" parse:"rate_limits"`
+
+	PasswordPolicy PasswordPolicy `env:"PASSWORD_"`
+}
+
+// PasswordPolicy restricts passwords chosen by users
+type PasswordPolicy struct {
+	MinLength     int  `env:"MIN_LENGTH" validate:"min=1,max=256"`
+	RequireUpper  bool `env:"REQUIRE_UPPER"`
+	RequireLower  bool `env:"REQUIRE_LOWER"`
+	RequireDigit  bool `env:"REQUIRE_DIGIT"`
+	RequireSymbol bool `env:"REQUIRE_SYMBOL"`
+}
+
+// RateLimit allows Requests per Period to the route for each subject of the
+// scope: ip address, user or the whole route
+type RateLimit struct {
+	Route    string
+	Scope    string
+	Requests int
+	Period   time.Duration
+}
+
+// TLS configuration of the main server, it is enabled when CertFile is set
+type TLSConfig struct {
+	CertFile       string        `env:"CERT_FILE"`
+	KeyFile        string        `env:"KEY_FILE"`
+	ClientCAFile   string        `env:"CLIENT_CA_FILE"`
+	ClientAuth     string        `env:"CLIENT_AUTH" validate:"oneof=none request verify_if_given require"`
+	MinVersion     uint16        `env:"MIN_VERSION" parse:"tls_version"`
+	CipherSuites   []uint16      `env:"CIPHER_SUITES" parse:"cipher_suites"`
+	ReloadInterval time.Duration `env:"RELOAD_INTERVAL_SEC" validate:"min=0"`
+	RedirectPort   string        `env:"REDIRECT_PORT" validate:"port"`
+	// ServiceIdentities lists client certificate identities allowed to authenticate
+	ServiceIdentities map[string]bool `env:"SERVICE_IDENTITIES"`
+	// AdminIdentities lists service identities with administrator access
+	AdminIdentities map[string]bool `env:"ADMIN_IDENTITIES"`
+}
+
+// Enabled reports whether the server should serve HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// Tracing configuration
+type TracingConfig struct {
+	Exporter     string  `env:"EXPORTER" validate:"oneof=none stdout otlp"`
+	OTLPEndpoint string  `env:"OTLP_ENDPOINT"`
+	ServiceName  string  `env:"SERVICE_NAME" validate:"required"`
+	SampleRatio  float64 `env:"SAMPLE_RATIO" validate:"min=0,max=1"`
 }
 
-// Main configuration
+// Main configuration, env tags of sections are prefixes of their variables
 type Config struct {
-	Logger   LoggerConfig
-	Database DatabaseConfig
-	Server   ServerConfig
+	Logger   LoggerConfig   `env:"LOG_"`
+	Database DatabaseConfig `env:"DATABASE_"`
+	Server   ServerConfig   `env:"SERVER_"`
+	Tracing  TracingConfig  `env:"TRACING_"`
 }
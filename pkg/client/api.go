@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// credentials is the request body of sign up and login
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// SignUp registers a new user
+func (c *Client) SignUp(ctx context.Context, username, password string) (iam.User, error) {
+	var user iam.User
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/signup",
+		body:   credentials{Username: username, Password: password},
+	}, &user)
+	return user, err
+}
+
+// Login issues a new token and saves it to the token store
+func (c *Client) Login(ctx context.Context, username, password string) (Token, error) {
+	var token Token
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/login",
+		body:   credentials{Username: username, Password: password},
+	}, &token)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if err := c.tokens.Save(ctx, token); err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// Refresh replaces stored token with a new one, the old token is revoked
+func (c *Client) Refresh(ctx context.Context) (Token, error) {
+	token, err := c.tokens.Load(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.AccessToken == "" {
+		return Token{}, ErrNoToken
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	return c.refresh(ctx, token)
+}
+
+// refresh exchanges the token, callers must hold refreshMu
+func (c *Client) refresh(ctx context.Context, token Token) (Token, error) {
+	var refreshed Token
+	if err := c.roundTrip(ctx, request{method: http.MethodPost, path: "/refresh", auth: true}, token, &refreshed); err != nil {
+		return Token{}, err
+	}
+
+	if err := c.tokens.Save(ctx, refreshed); err != nil {
+		return Token{}, err
+	}
+	return refreshed, nil
+}
+
+// Logout revokes stored token and clears the token store, the store is
+// cleared even if the server fails to revoke the token
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.do(ctx, request{method: http.MethodPost, path: "/logout", auth: true}, nil)
+	if clearErr := c.tokens.Clear(ctx); clearErr != nil && err == nil {
+		return clearErr
+	}
+	return err
+}
+
+// CurrentUser returns the user owning stored token
+func (c *Client) CurrentUser(ctx context.Context) (iam.User, error) {
+	var user iam.User
+	err := c.do(ctx, request{method: http.MethodGet, path: "/user", auth: true}, &user)
+	return user, err
+}
+
+// ListAuditEvents queries audit log, requires administrator token
+func (c *Client) ListAuditEvents(ctx context.Context, filter db.AuditEventFilter) ([]iam.AuditEvent, error) {
+	query := url.Values{}
+	if filter.Actor != "" {
+		query.Set("actor", filter.Actor)
+	}
+	if filter.Action != "" {
+		query.Set("action", filter.Action)
+	}
+	if filter.Target != "" {
+		query.Set("target", filter.Target)
+	}
+	if filter.Result != "" {
+		query.Set("result", filter.Result)
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.AfterId > 0 {
+		query.Set("after_id", strconv.FormatInt(filter.AfterId, 10))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var events []iam.AuditEvent
+	err := c.do(ctx, request{method: http.MethodGet, path: "/admin/audit", query: query, auth: true}, &events)
+	return events, err
+}
@@ -0,0 +1,291 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxRetries    = 3
+	DefaultRetryBackoff  = 200 * time.Millisecond
+	DefaultMaxBackoff    = 5 * time.Second
+	DefaultRefreshBefore = 5 * time.Minute
+	APIVersionPrefix     = "/v1"
+)
+
+// Client is a typed HTTP client of the tripidium API
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	tokens        TokenStore
+	maxRetries    int
+	retryBackoff  time.Duration
+	maxBackoff    time.Duration
+	refreshBefore time.Duration
+
+	// refreshMu serializes token refreshes of concurrent requests
+	refreshMu sync.Mutex
+}
+
+// Option configures the client
+type Option func(*Client)
+
+// WithHTTPClient sets underlying HTTP client, http.DefaultClient is used by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTokenStore sets storage of the access token, MemoryTokenStore is used by default
+func WithTokenStore(store TokenStore) Option {
+	return func(c *Client) {
+		c.tokens = store
+	}
+}
+
+// WithRetry sets maximum number of retries of rate limited and unavailable
+// responses and the initial backoff doubled after each attempt
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithMaxBackoff sets the cap of retry delays, a response asking to retry
+// later than that fails without retries
+func WithMaxBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		c.maxBackoff = d
+	}
+}
+
+// WithRefreshBefore sets how long before expiration the token is refreshed,
+// zero disables automatic refresh
+func WithRefreshBefore(d time.Duration) Option {
+	return func(c *Client) {
+		c.refreshBefore = d
+	}
+}
+
+// New creates a client of the API served at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url: %s, scheme must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:       u,
+		httpClient:    http.DefaultClient,
+		tokens:        &MemoryTokenStore{},
+		maxRetries:    DefaultMaxRetries,
+		retryBackoff:  DefaultRetryBackoff,
+		maxBackoff:    DefaultMaxBackoff,
+		refreshBefore: DefaultRefreshBefore,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// request describes API call, body is encoded on each attempt so it can be retried
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	auth   bool
+}
+
+// do performs the request with stored token if required and decodes JSON response into out if not nil
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var token Token
+	if req.auth {
+		var err error
+		if token, err = c.validToken(ctx); err != nil {
+			return err
+		}
+	}
+
+	return c.roundTrip(ctx, req, token, out)
+}
+
+// roundTrip sends the request retrying rate limited and unavailable responses
+func (c *Client) roundTrip(ctx context.Context, req request, token Token, out any) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, token)
+		if err != nil {
+			return err
+		}
+
+		if !c.shouldRetry(resp.StatusCode) || attempt >= c.maxRetries {
+			return decodeResponse(resp, out)
+		}
+
+		// Retry-After beyond the backoff cap fails the request instead of
+		// retrying earlier than the server allows
+		delay, ok := c.backoff(attempt, resp.Header.Get("Retry-After"))
+		if !ok {
+			return decodeResponse(resp, out)
+		}
+		drainBody(resp)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// send performs single HTTP request
+func (c *Client) send(ctx context.Context, req request, token Token) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += APIVersionPrefix + req.path
+	if len(req.query) > 0 {
+		u.RawQuery = req.query.Encode()
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		b, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.auth {
+		httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+
+	return c.httpClient.Do(httpReq)
+}
+
+// shouldRetry reports whether response status is transient
+func (c *Client) shouldRetry(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// backoff returns delay before the next attempt, Retry-After takes precedence
+// over exponential backoff with full jitter. It reports false if Retry-After
+// exceeds the maximum backoff.
+func (c *Client) backoff(attempt int, retryAfter string) (time.Duration, bool) {
+	if retryAfter != "" {
+		delay, ok := time.Duration(0), false
+		if sec, err := strconv.Atoi(retryAfter); err == nil && sec >= 0 {
+			delay, ok = time.Duration(sec)*time.Second, true
+		} else if t, err := http.ParseTime(retryAfter); err == nil {
+			delay, ok = max(time.Until(t), 0), true
+		}
+		if ok {
+			return delay, delay <= c.maxBackoff
+		}
+	}
+
+	d := min(c.retryBackoff<<attempt, c.maxBackoff)
+	if d <= 0 {
+		return 0, true
+	}
+	return rand.N(d) + 1, true
+}
+
+// decodeResponse closes the body, turning error responses into *APIError
+func decodeResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if err := json.Unmarshal(body, &apiErr.envelope); err != nil {
+			apiErr.Message = strings.TrimSpace(string(body))
+		} else {
+			apiErr.Code = apiErr.envelope.Error
+			apiErr.Message = apiErr.envelope.Message
+			apiErr.Fields = apiErr.envelope.Fields
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		drainBody(resp)
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// drainBody reads the rest of the body to let the connection be reused
+func drainBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// validToken returns stored token, refreshing it when it is about to expire
+func (c *Client) validToken(ctx context.Context) (Token, error) {
+	token, err := c.tokens.Load(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.AccessToken == "" {
+		return Token{}, ErrNoToken
+	}
+	if c.refreshBefore <= 0 || time.Until(token.ExpiresAt) > c.refreshBefore {
+		return token, nil
+	}
+	if !token.ExpiresAt.After(time.Now()) {
+		return Token{}, ErrTokenExpired
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// Another request could have refreshed the token while waiting for the lock
+	current, err := c.tokens.Load(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	if current.AccessToken != token.AccessToken {
+		return current, nil
+	}
+
+	refreshed, err := c.refresh(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return Token{}, err
+		}
+		// Token is still valid, refresh is retried on the next request
+		return token, nil
+	}
+	return refreshed, nil
+}
@@ -0,0 +1,368 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/internal/config"
+	"github.com/kompotkot/tripidium/internal/health"
+	"github.com/kompotkot/tripidium/internal/ratelimit"
+	"github.com/kompotkot/tripidium/internal/server"
+	"github.com/kompotkot/tripidium/internal/types"
+	"github.com/kompotkot/tripidium/pkg/client"
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/db/memory"
+)
+
+const (
+	testUsername = "alice"
+	testPassword = "correct-horse"
+)
+
+// newTestHandler builds the API handler on a migrated in-memory database,
+// configure adjusts default configuration
+func newTestHandler(t *testing.T, configure func(cfg *types.Config)) http.Handler {
+	t.Helper()
+
+	database, err := memory.NewMemoryDB("")
+	if err != nil {
+		t.Fatalf("NewMemoryDB: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	cfg := config.Defaults()
+	cfg.Server.RateLimits = nil
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	srv, err := server.NewServer(server.Dependencies{
+		DB:             database,
+		Cfg:            cfg.Server,
+		Log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Health:         health.NewChecker(0),
+		RateLimitStore: ratelimit.NewMemoryStore(),
+		Config:         &cfg,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return *srv.BuildCommonHandler()
+}
+
+// newTestClient starts httptest server with the handler and returns its client
+func newTestClient(t *testing.T, handler http.Handler, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c, err := client.New(ts.URL, append([]client.Option{client.WithHTTPClient(ts.Client())}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+// mustLogin signs up the test user and logs in
+func mustLogin(t *testing.T, c *client.Client) client.Token {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := c.SignUp(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+	token, err := c.Login(ctx, testUsername, testPassword)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return token
+}
+
+func TestLoginRefreshLogout(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t, nil)
+	store := &client.MemoryTokenStore{}
+	c := newTestClient(t, handler, client.WithTokenStore(store))
+
+	token := mustLogin(t, c)
+	if token.AccessToken == "" || token.TokenType != "Bearer" || !token.ExpiresAt.After(time.Now()) {
+		t.Fatalf("Login token = %+v, want active bearer token", token)
+	}
+	if stored, _ := store.Load(ctx); stored != token {
+		t.Errorf("stored token = %+v, want %+v", stored, token)
+	}
+
+	user, err := c.CurrentUser(ctx)
+	if err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+	if user.Username != testUsername {
+		t.Errorf("CurrentUser username = %q, want %q", user.Username, testUsername)
+	}
+
+	refreshed, err := c.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.AccessToken == token.AccessToken {
+		t.Errorf("Refresh returned the same token")
+	}
+	if stored, _ := store.Load(ctx); stored != refreshed {
+		t.Errorf("stored token after Refresh = %+v, want %+v", stored, refreshed)
+	}
+
+	// The replaced token is revoked
+	oldStore := &client.MemoryTokenStore{}
+	oldStore.Save(ctx, token)
+	old := newTestClient(t, handler, client.WithTokenStore(oldStore))
+	if _, err := old.CurrentUser(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("CurrentUser with replaced token: err = %v, want %v", err, client.ErrUnauthorized)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if stored, _ := store.Load(ctx); stored != (client.Token{}) {
+		t.Errorf("stored token after Logout = %+v, want none", stored)
+	}
+	if _, err := c.CurrentUser(ctx); !errors.Is(err, client.ErrNoToken) {
+		t.Errorf("CurrentUser after Logout: err = %v, want %v", err, client.ErrNoToken)
+	}
+
+	// The logged out token is revoked
+	oldStore.Save(ctx, refreshed)
+	if _, err := old.CurrentUser(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("CurrentUser with logged out token: err = %v, want %v", err, client.ErrUnauthorized)
+	}
+}
+
+func TestLogoutClearsTokenOnFailure(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t, nil)
+	c := newTestClient(t, handler)
+	token := mustLogin(t, c)
+
+	// Revoke the token behind the client's back, so logout is rejected
+	otherStore := &client.MemoryTokenStore{}
+	otherStore.Save(ctx, token)
+	other := newTestClient(t, handler, client.WithTokenStore(otherStore))
+	if err := other.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if err := c.Logout(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Logout with revoked token: err = %v, want %v", err, client.ErrUnauthorized)
+	}
+	if _, err := c.CurrentUser(ctx); !errors.Is(err, client.ErrNoToken) {
+		t.Errorf("CurrentUser after failed Logout: err = %v, want %v", err, client.ErrNoToken)
+	}
+}
+
+func TestAutomaticRefresh(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t, nil)
+	store := &client.MemoryTokenStore{}
+	// Tokens live a day, so every authenticated request refreshes them
+	c := newTestClient(t, handler, client.WithTokenStore(store), client.WithRefreshBefore(48*time.Hour))
+
+	token := mustLogin(t, c)
+	if _, err := c.CurrentUser(ctx); err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+
+	stored, _ := store.Load(ctx)
+	if stored.AccessToken == "" || stored.AccessToken == token.AccessToken {
+		t.Errorf("stored token = %+v, want refreshed token", stored)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, newTestHandler(t, nil))
+
+	if _, err := c.CurrentUser(ctx); !errors.Is(err, client.ErrNoToken) {
+		t.Errorf("CurrentUser without login: err = %v, want %v", err, client.ErrNoToken)
+	}
+
+	mustLogin(t, c)
+
+	_, err := c.SignUp(ctx, testUsername, testPassword)
+	if !errors.Is(err, db.ErrUserAlreadyExists) {
+		t.Errorf("SignUp of existing user: err = %v, want %v", err, db.ErrUserAlreadyExists)
+	}
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("SignUp of existing user: err = %#v, want APIError with status %d", err, http.StatusConflict)
+	}
+
+	if _, err := c.Login(ctx, testUsername, "wrong-password"); !errors.Is(err, client.ErrInvalidCredentials) {
+		t.Errorf("Login with wrong password: err = %v, want %v", err, client.ErrInvalidCredentials)
+	}
+
+	_, err = c.SignUp(ctx, "bob", "short")
+	if !errors.Is(err, client.ErrValidation) {
+		t.Errorf("SignUp with short password: err = %v, want %v", err, client.ErrValidation)
+	}
+	if !errors.As(err, &apiErr) || apiErr.Fields["password"] == "" {
+		t.Errorf("SignUp with short password: err = %#v, want violation of password field", err)
+	}
+
+	if _, err := c.ListAuditEvents(ctx, db.AuditEventFilter{}); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("ListAuditEvents as regular user: err = %v, want %v", err, client.ErrForbidden)
+	}
+}
+
+func TestRetryUnavailable(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t, nil)
+
+	// Fail the first requests as an overloaded proxy in front of the server would
+	var requests, failures atomic.Int32
+	failures.Store(2)
+	flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, flaky, client.WithRetry(2, time.Millisecond))
+	if _, err := c.SignUp(ctx, testUsername, testPassword); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+
+	// Retries are exhausted
+	requests.Store(0)
+	failures.Store(2)
+	c = newTestClient(t, flaky, client.WithRetry(1, time.Millisecond))
+	if _, err := c.Login(ctx, testUsername, testPassword); !errors.Is(err, client.ErrUnavailable) {
+		t.Errorf("Login: err = %v, want %v", err, client.ErrUnavailable)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t, func(cfg *types.Config) {
+		cfg.Server.RateLimits = []types.RateLimit{
+			{Route: "signup", Scope: server.RateLimitScopeIP, Requests: 1, Period: time.Second},
+		}
+	})
+	c := newTestClient(t, handler, client.WithRetry(3, time.Millisecond))
+
+	if _, err := c.SignUp(ctx, "alice", testPassword); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+
+	// The second sign up waits for Retry-After of the server
+	start := time.Now()
+	if _, err := c.SignUp(ctx, "bob", testPassword); err != nil {
+		t.Fatalf("SignUp after rate limit: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("SignUp retried after %v, before Retry-After", elapsed)
+	}
+}
+
+func TestRetryAfterBeyondMaxBackoff(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t, func(cfg *types.Config) {
+		cfg.Server.RateLimits = []types.RateLimit{
+			{Route: "signup", Scope: server.RateLimitScopeIP, Requests: 1, Period: time.Hour},
+		}
+	})
+
+	var requests atomic.Int32
+	counted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	})
+	c := newTestClient(t, counted, client.WithRetry(3, time.Millisecond), client.WithMaxBackoff(time.Second))
+
+	if _, err := c.SignUp(ctx, "alice", testPassword); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+
+	_, err := c.SignUp(ctx, "bob", testPassword)
+	if !errors.Is(err, client.ErrRateLimited) {
+		t.Errorf("SignUp: err = %v, want %v", err, client.ErrRateLimited)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2 without retries", got)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	sentinels := map[string]error{
+		server.ErrorCodeBadRequest:           client.ErrBadRequest,
+		server.ErrorCodeValidation:           client.ErrValidation,
+		server.ErrorCodeUnsupportedMediaType: client.ErrUnsupportedMediaType,
+		server.ErrorCodeRequestTooLarge:      client.ErrRequestTooLarge,
+		server.ErrorCodeUnauthorized:         client.ErrUnauthorized,
+		server.ErrorCodeInvalidCredentials:   client.ErrInvalidCredentials,
+		server.ErrorCodeForbidden:            client.ErrForbidden,
+		server.ErrorCodeNotFound:             client.ErrNotFound,
+		server.ErrorCodeCORSRejected:         client.ErrCORSRejected,
+		server.ErrorCodeRateLimited:          client.ErrRateLimited,
+		server.ErrorCodeInvalidConfig:        client.ErrInvalidConfig,
+		server.ErrorCodeInternal:             client.ErrInternal,
+	}
+
+	// Every ErrorCode constant of the server must be listed above
+	file, err := parser.ParseFile(token.NewFileSet(), "../../internal/server/errors.go", nil, 0)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for i, name := range spec.(*ast.ValueSpec).Names {
+				if !strings.HasPrefix(name.Name, "ErrorCode") {
+					continue
+				}
+				code, err := strconv.Unquote(spec.(*ast.ValueSpec).Values[i].(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatalf("%s: %v", name.Name, err)
+				}
+				if _, ok := sentinels[code]; !ok {
+					t.Errorf("server.%s = %q has no client sentinel", name.Name, code)
+				}
+			}
+		}
+	}
+
+	// Status without own sentinel shows the mapping comes from the code
+	for code, want := range sentinels {
+		err := &client.APIError{StatusCode: http.StatusTeapot, Code: code}
+		if !errors.Is(err, want) {
+			t.Errorf("APIError with code %s: errors.Is(%v) = false", code, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+var (
+	ErrNoToken              = errors.New("no access token, login first")
+	ErrTokenExpired         = errors.New("access token expired, login again")
+	ErrBadRequest           = errors.New("bad request")
+	ErrValidation           = errors.New("validation failed")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrRequestTooLarge      = errors.New("request too large")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrInvalidCredentials   = errors.New("invalid username or password")
+	ErrForbidden            = errors.New("forbidden")
+	ErrNotFound             = errors.New("not found")
+	ErrCORSRejected         = errors.New("cross-origin request rejected")
+	ErrRateLimited          = errors.New("rate limited")
+	ErrInvalidConfig        = errors.New("invalid configuration")
+	ErrUnavailable          = errors.New("service unavailable")
+	ErrInternal             = errors.New("internal server error")
+)
+
+// errorCodes maps API error codes not owned by the database layer to sentinels
+var errorCodes = map[string]error{
+	"bad_request":            ErrBadRequest,
+	"validation_failed":      ErrValidation,
+	"unsupported_media_type": ErrUnsupportedMediaType,
+	"request_too_large":      ErrRequestTooLarge,
+	"unauthorized":           ErrUnauthorized,
+	"invalid_credentials":    ErrInvalidCredentials,
+	"forbidden":              ErrForbidden,
+	"not_found":              ErrNotFound,
+	"cors_rejected":          ErrCORSRejected,
+	"rate_limited":           ErrRateLimited,
+	"invalid_config":         ErrInvalidConfig,
+	"internal_error":         ErrInternal,
+}
+
+// APIError is an error response of the API, it wraps sentinel error of its
+// code, so errors.Is(err, db.ErrUserAlreadyExists) works on the client side
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// Fields maps invalid request fields to violation messages
+	Fields map[string]string
+
+	envelope struct {
+		Error   string            `json:"error"`
+		Message string            `json:"message"`
+		Fields  map[string]string `json:"fields"`
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("api error: status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("api error: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Unwrap returns sentinel error matching error code or status
+func (e *APIError) Unwrap() error {
+	if err := db.ErrorFromCode(e.Code); err != nil {
+		return err
+	}
+	if err, ok := errorCodes[e.Code]; ok {
+		return err
+	}
+
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusRequestEntityTooLarge:
+		return ErrRequestTooLarge
+	case http.StatusUnsupportedMediaType:
+		return ErrUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	if e.StatusCode >= http.StatusInternalServerError {
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Token is the bearer access token issued by login and refresh
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// TokenStore keeps the access token between requests, implementations must
+// be safe for concurrent use
+type TokenStore interface {
+	// Load returns stored token or zero Token if there is none
+	Load(ctx context.Context) (Token, error)
+	Save(ctx context.Context, token Token) error
+	Clear(ctx context.Context) error
+}
+
+// MemoryTokenStore keeps the token in process memory
+type MemoryTokenStore struct {
+	mu    sync.RWMutex
+	token Token
+}
+
+func (s *MemoryTokenStore) Load(ctx context.Context) (Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token, nil
+}
+
+func (s *MemoryTokenStore) Save(ctx context.Context, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	return nil
+}
+
+func (s *MemoryTokenStore) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = Token{}
+	return nil
+}
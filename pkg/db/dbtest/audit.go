@@ -0,0 +1,149 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+func testAuditEvents(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	before := time.Now()
+	first, err := database.CreateAuditEvent(ctx, iam.AuditEvent{
+		Actor:     "alice",
+		Action:    iam.AuditActionLogin,
+		Target:    "alice",
+		IP:        "127.0.0.1",
+		UserAgent: "dbtest",
+		RequestId: "request-1",
+		Result:    iam.AuditResultSuccess,
+	})
+	if err != nil {
+		t.Fatalf("CreateAuditEvent: %v", err)
+	}
+	after := time.Now()
+
+	if first.Id <= 0 {
+		t.Errorf("Id = %d, want positive", first.Id)
+	}
+	if first.PrevHash != "" {
+		t.Errorf("PrevHash of the first event = %q, want empty", first.PrevHash)
+	}
+	if first.Hash == "" || first.Hash != first.ComputeHash() {
+		t.Errorf("Hash = %q, want %q", first.Hash, first.ComputeHash())
+	}
+	// Zero CreatedAt is set to the current time
+	checkTimeBetween(t, "CreatedAt", first.CreatedAt, before, after)
+
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	second, err := database.CreateAuditEvent(ctx, iam.AuditEvent{
+		Actor:     "bob",
+		Action:    iam.AuditActionLoginFailed,
+		Result:    iam.AuditResultFailure,
+		CreatedAt: createdAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateAuditEvent: %v", err)
+	}
+	if second.Id <= first.Id {
+		t.Errorf("Id = %d, want greater than %d", second.Id, first.Id)
+	}
+	if second.PrevHash != first.Hash {
+		t.Errorf("PrevHash = %q, want hash of the previous event %q", second.PrevHash, first.Hash)
+	}
+	checkTimeEqual(t, "CreatedAt", second.CreatedAt, createdAt)
+
+	// Stored events hash to the returned values
+	events, err := database.ListAuditEvents(ctx, db.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("ListAuditEvents returned %d events, want 2", len(events))
+	}
+	for i, want := range []iam.AuditEvent{first, second} {
+		checkAuditEvent(t, events[i], want)
+		if hash := events[i].ComputeHash(); hash != events[i].Hash {
+			t.Errorf("stored event %d hashes to %q, want %q", events[i].Id, hash, events[i].Hash)
+		}
+	}
+}
+
+func testListAuditEvents(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	events, err := database.ListAuditEvents(ctx, db.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if events == nil || len(events) != 0 {
+		t.Fatalf("ListAuditEvents on empty database = %#v, want empty non-nil slice", events)
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inputs := []iam.AuditEvent{
+		{Actor: "alice", Action: iam.AuditActionSignUp, Target: "alice", Result: iam.AuditResultSuccess},
+		{Actor: "alice", Action: iam.AuditActionLogin, Target: "alice", Result: iam.AuditResultSuccess},
+		{Actor: "bob", Action: iam.AuditActionLoginFailed, Target: "bob", Result: iam.AuditResultFailure},
+		{Actor: "admin", Action: iam.AuditActionUserDisable, Target: "bob", Result: iam.AuditResultSuccess},
+		{Actor: "alice", Action: iam.AuditActionLogin, Target: "alice", Result: iam.AuditResultFailure},
+	}
+	var created []iam.AuditEvent
+	for i, e := range inputs {
+		e.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		event, err := database.CreateAuditEvent(ctx, e)
+		if err != nil {
+			t.Fatalf("CreateAuditEvent: %v", err)
+		}
+		created = append(created, event)
+	}
+
+	filters := []struct {
+		name   string
+		filter db.AuditEventFilter
+		want   []int
+	}{
+		{"all", db.AuditEventFilter{}, []int{0, 1, 2, 3, 4}},
+		{"actor", db.AuditEventFilter{Actor: "alice"}, []int{0, 1, 4}},
+		{"action", db.AuditEventFilter{Action: iam.AuditActionLogin}, []int{1, 4}},
+		{"target", db.AuditEventFilter{Target: "bob"}, []int{2, 3}},
+		{"result", db.AuditEventFilter{Result: iam.AuditResultFailure}, []int{2, 4}},
+		{"combined", db.AuditEventFilter{Actor: "alice", Result: iam.AuditResultSuccess}, []int{0, 1}},
+		{"since inclusive", db.AuditEventFilter{Since: base.Add(2 * time.Hour)}, []int{2, 3, 4}},
+		{"until exclusive", db.AuditEventFilter{Until: base.Add(2 * time.Hour)}, []int{0, 1}},
+		{"since and until", db.AuditEventFilter{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, []int{1, 2}},
+		{"after id", db.AuditEventFilter{AfterId: created[2].Id}, []int{3, 4}},
+		{"limit", db.AuditEventFilter{Limit: 2}, []int{0, 1}},
+		{"after id and limit", db.AuditEventFilter{AfterId: created[0].Id, Limit: 2}, []int{1, 2}},
+		{"no match", db.AuditEventFilter{Actor: "carol"}, []int{}},
+	}
+
+	for _, f := range filters {
+		events, err := database.ListAuditEvents(ctx, f.filter)
+		if err != nil {
+			t.Errorf("ListAuditEvents %s: %v", f.name, err)
+			continue
+		}
+		if len(events) != len(f.want) {
+			t.Errorf("ListAuditEvents %s returned %d events, want %d", f.name, len(events), len(f.want))
+			continue
+		}
+		for i, idx := range f.want {
+			checkAuditEvent(t, events[i], created[idx])
+		}
+	}
+}
+
+func checkAuditEvent(t *testing.T, got, want iam.AuditEvent) {
+	t.Helper()
+	createdAt := got.CreatedAt
+	got.CreatedAt = want.CreatedAt
+	if got != want || !createdAt.Equal(want.CreatedAt) {
+		got.CreatedAt = createdAt
+		t.Errorf("audit event = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,546 @@
+// Package dbtest is a conformance suite for db.Database implementations.
+//
+// A backend runs the suite from its own test with a function opening an
+// empty, migrated database:
+//
+//	func TestConformance(t *testing.T) {
+//		dbtest.Run(t, func(t *testing.T) db.Database {
+//			database, err := db.CreateDatabase("sqlite", db.Options{URI: filepath.Join(t.TempDir(), "test.db")})
+//			...
+//			return database
+//		})
+//	}
+//
+// Each subtest opens its own database, subtests are not run in parallel, so
+// a backend may reset shared storage in the open function.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// OpenFunc returns an empty database with applied migrations, the database
+// must be closed by a cleanup function registered on t
+type OpenFunc func(t *testing.T) db.Database
+
+// timeSlack is the allowed difference between the test clock and timestamps
+// set by the database server
+const timeSlack = time.Second
+
+// timePrecision is the coarsest precision of stored timestamps
+const timePrecision = time.Microsecond
+
+// Run runs the conformance suite against databases returned by open
+func Run(t *testing.T, open OpenFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, database db.Database)
+	}{
+		{"Migrations", testMigrations},
+		{"CreateUser", testCreateUser},
+		{"GetUser", testGetUser},
+		{"ListUsers", testListUsers},
+		{"UpdateUser", testUpdateUser},
+		{"CreateToken", testCreateToken},
+		{"GetToken", testGetToken},
+		{"RevokeToken", testRevokeToken},
+		{"ListTokens", testListTokens},
+		{"AuditEvents", testAuditEvents},
+		{"ListAuditEvents", testListAuditEvents},
+		{"RateLimits", testRateLimits},
+		{"WithTx", testWithTx},
+		{"Concurrency", testConcurrency},
+		{"ContextCancellation", testContextCancellation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+func testMigrations(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	migrations := database.Migrations()
+	if len(migrations) == 0 {
+		t.Fatal("no migrations known to the implementation")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %d has version %d, versions must start at 1 without gaps", i, m.Version)
+		}
+		if m.Name == "" {
+			t.Errorf("migration %d has no name", m.Version)
+		}
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	checkVersion := func(want int) {
+		t.Helper()
+		current, known, err := database.SchemaVersion(ctx)
+		if err != nil {
+			t.Fatalf("SchemaVersion: %v", err)
+		}
+		if current != want || known != latest {
+			t.Fatalf("SchemaVersion = %d, %d, want %d, %d", current, known, want, latest)
+		}
+	}
+
+	checkVersion(latest)
+
+	// Applying an up to date schema is a no-op
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate on up to date schema: %v", err)
+	}
+	checkVersion(latest)
+
+	for version := latest - 1; version >= 0; version-- {
+		if err := database.Rollback(ctx, version); err != nil {
+			t.Fatalf("Rollback(%d): %v", version, err)
+		}
+		checkVersion(version)
+	}
+
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate after rollback: %v", err)
+	}
+	checkVersion(latest)
+
+	// Schema is usable after full rollback and migration
+	if _, err := database.CreateUser(ctx, "migrated", "hash"); err != nil {
+		t.Fatalf("CreateUser after migration: %v", err)
+	}
+}
+
+func testCreateUser(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	before := time.Now()
+	user, err := database.CreateUser(ctx, "alice", "alice-hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	after := time.Now()
+
+	if user.Id == "" {
+		t.Error("created user has empty Id")
+	}
+	if user.Username != "alice" || user.PasswordHash != "alice-hash" {
+		t.Errorf("created user = %q, %q, want %q, %q", user.Username, user.PasswordHash, "alice", "alice-hash")
+	}
+	if user.IsAdmin || user.IsDisabled {
+		t.Errorf("created user IsAdmin = %t, IsDisabled = %t, want false", user.IsAdmin, user.IsDisabled)
+	}
+	checkTimeBetween(t, "CreatedAt", user.CreatedAt, before, after)
+	if !user.UpdatedAt.Equal(user.CreatedAt) {
+		t.Errorf("UpdatedAt = %v, want CreatedAt %v", user.UpdatedAt, user.CreatedAt)
+	}
+
+	stored, err := database.GetUser(ctx, user.Id, "")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	checkUser(t, stored, user)
+
+	if _, err := database.CreateUser(ctx, "alice", "other-hash"); !errors.Is(err, db.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser with taken username: err = %v, want %v", err, db.ErrUserAlreadyExists)
+	}
+
+	// Failed insert keeps the existing user
+	stored, err = database.GetUser(ctx, "", "alice")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	checkUser(t, stored, user)
+
+	other, err := database.CreateUser(ctx, "bob", "bob-hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if other.Id == user.Id {
+		t.Errorf("users got the same Id %q", user.Id)
+	}
+}
+
+func testGetUser(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	alice := mustCreateUser(t, database, "alice")
+	bob := mustCreateUser(t, database, "bob")
+
+	lookups := []struct {
+		name     string
+		userId   string
+		username string
+		want     *iam.User
+	}{
+		{"by id", alice.Id, "", &alice},
+		{"by username", "", "bob", &bob},
+		{"by id and username", alice.Id, "alice", &alice},
+		{"mismatched id and username", alice.Id, "bob", nil},
+		{"unknown username", "", "carol", nil},
+		{"unknown id", unknownId(alice.Id), "", nil},
+		{"malformed id", "not-an-id", "", nil},
+		{"no id and username", "", "", nil},
+	}
+
+	for _, l := range lookups {
+		user, err := database.GetUser(ctx, l.userId, l.username)
+		if l.want == nil {
+			if !errors.Is(err, db.ErrUserNotFound) {
+				t.Errorf("GetUser %s: err = %v, want %v", l.name, err, db.ErrUserNotFound)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetUser %s: %v", l.name, err)
+			continue
+		}
+		checkUser(t, user, *l.want)
+	}
+}
+
+func testListUsers(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	users, err := database.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if users == nil || len(users) != 0 {
+		t.Fatalf("ListUsers on empty database = %#v, want empty non-nil slice", users)
+	}
+
+	created := map[string]iam.User{}
+	for _, name := range []string{"carol", "alice", "bob"} {
+		created[name] = mustCreateUser(t, database, name)
+	}
+
+	users, err = database.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	want := []string{"alice", "bob", "carol"}
+	if len(users) != len(want) {
+		t.Fatalf("ListUsers returned %d users, want %d", len(users), len(want))
+	}
+	for i, name := range want {
+		checkUser(t, users[i], created[name])
+	}
+}
+
+func testUpdateUser(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	user := mustCreateUser(t, database, "alice")
+	time.Sleep(10 * time.Millisecond)
+
+	hash := "new-hash"
+	isAdmin := true
+	updated, err := database.UpdateUser(ctx, user.Id, db.UserUpdate{PasswordHash: &hash, IsAdmin: &isAdmin})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.PasswordHash != hash || !updated.IsAdmin || updated.IsDisabled {
+		t.Errorf("updated user PasswordHash = %q, IsAdmin = %t, IsDisabled = %t, want %q, true, false",
+			updated.PasswordHash, updated.IsAdmin, updated.IsDisabled, hash)
+	}
+	if updated.Id != user.Id || updated.Username != user.Username {
+		t.Errorf("updated user = %q, %q, want %q, %q", updated.Id, updated.Username, user.Id, user.Username)
+	}
+	if !updated.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("CreatedAt changed from %v to %v", user.CreatedAt, updated.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(user.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want after %v", updated.UpdatedAt, user.UpdatedAt)
+	}
+
+	stored, err := database.GetUser(ctx, user.Id, "")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	checkUser(t, stored, updated)
+
+	// Nil fields are kept
+	isDisabled := true
+	disabled, err := database.UpdateUser(ctx, user.Id, db.UserUpdate{IsDisabled: &isDisabled})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if disabled.PasswordHash != hash || !disabled.IsAdmin || !disabled.IsDisabled {
+		t.Errorf("disabled user PasswordHash = %q, IsAdmin = %t, IsDisabled = %t, want %q, true, true",
+			disabled.PasswordHash, disabled.IsAdmin, disabled.IsDisabled, hash)
+	}
+
+	// Empty update only touches UpdatedAt
+	touched, err := database.UpdateUser(ctx, user.Id, db.UserUpdate{})
+	if err != nil {
+		t.Fatalf("UpdateUser with empty update: %v", err)
+	}
+	if touched.PasswordHash != disabled.PasswordHash || touched.IsAdmin != disabled.IsAdmin || touched.IsDisabled != disabled.IsDisabled {
+		t.Errorf("empty update changed user from %+v to %+v", disabled, touched)
+	}
+	if touched.UpdatedAt.Before(disabled.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want not before %v", touched.UpdatedAt, disabled.UpdatedAt)
+	}
+
+	for _, userId := range []string{unknownId(user.Id), "not-an-id"} {
+		if _, err := database.UpdateUser(ctx, userId, db.UserUpdate{IsAdmin: &isAdmin}); !errors.Is(err, db.ErrUserNotFound) {
+			t.Errorf("UpdateUser(%q): err = %v, want %v", userId, err, db.ErrUserNotFound)
+		}
+	}
+}
+
+func testCreateToken(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	user := mustCreateUser(t, database, "alice")
+	expiresAt := time.Now().Add(time.Hour)
+
+	before := time.Now()
+	token, err := database.CreateToken(ctx, user.Id, expiresAt)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	after := time.Now()
+
+	if token.Id == "" {
+		t.Error("created token has empty Id")
+	}
+	if token.UserId != user.Id {
+		t.Errorf("UserId = %q, want %q", token.UserId, user.Id)
+	}
+	if token.IsRevoked {
+		t.Error("created token is revoked")
+	}
+	checkTimeEqual(t, "ExpiresAt", token.ExpiresAt, expiresAt)
+	checkTimeBetween(t, "IssuedAt", token.IssuedAt, before, after)
+	if !token.UpdatedAt.Equal(token.IssuedAt) {
+		t.Errorf("UpdatedAt = %v, want IssuedAt %v", token.UpdatedAt, token.IssuedAt)
+	}
+
+	other, err := database.CreateToken(ctx, user.Id, expiresAt)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if other.Id == token.Id {
+		t.Errorf("tokens got the same Id %q", token.Id)
+	}
+
+	for _, userId := range []string{unknownId(user.Id), "not-an-id"} {
+		if _, err := database.CreateToken(ctx, userId, expiresAt); !errors.Is(err, db.ErrUserNotFound) {
+			t.Errorf("CreateToken(%q): err = %v, want %v", userId, err, db.ErrUserNotFound)
+		}
+	}
+}
+
+func testGetToken(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	user := mustCreateUser(t, database, "alice")
+	token := mustCreateToken(t, database, user.Id)
+
+	stored, err := database.GetToken(ctx, token.Id)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	checkToken(t, stored, token)
+
+	for _, tokenId := range []string{unknownId(token.Id), "not-an-id", ""} {
+		if _, err := database.GetToken(ctx, tokenId); !errors.Is(err, db.ErrTokenNotFound) {
+			t.Errorf("GetToken(%q): err = %v, want %v", tokenId, err, db.ErrTokenNotFound)
+		}
+	}
+}
+
+func testRevokeToken(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	user := mustCreateUser(t, database, "alice")
+	token := mustCreateToken(t, database, user.Id)
+	kept := mustCreateToken(t, database, user.Id)
+	time.Sleep(10 * time.Millisecond)
+
+	if err := database.RevokeToken(ctx, token.Id); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	revoked, err := database.GetToken(ctx, token.Id)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if !revoked.IsRevoked {
+		t.Error("token is not revoked")
+	}
+	if !revoked.UpdatedAt.After(token.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want after %v", revoked.UpdatedAt, token.UpdatedAt)
+	}
+	if !revoked.IssuedAt.Equal(token.IssuedAt) {
+		t.Errorf("IssuedAt changed from %v to %v", token.IssuedAt, revoked.IssuedAt)
+	}
+
+	// Revoking is idempotent
+	if err := database.RevokeToken(ctx, token.Id); err != nil {
+		t.Errorf("RevokeToken of revoked token: %v", err)
+	}
+
+	// Other tokens of the user are not affected
+	stored, err := database.GetToken(ctx, kept.Id)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	checkToken(t, stored, kept)
+
+	for _, tokenId := range []string{unknownId(token.Id), "not-an-id"} {
+		if err := database.RevokeToken(ctx, tokenId); !errors.Is(err, db.ErrTokenNotFound) {
+			t.Errorf("RevokeToken(%q): err = %v, want %v", tokenId, err, db.ErrTokenNotFound)
+		}
+	}
+}
+
+func testListTokens(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	alice := mustCreateUser(t, database, "alice")
+	bob := mustCreateUser(t, database, "bob")
+
+	tokens, err := database.ListTokens(ctx, alice.Id)
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if tokens == nil || len(tokens) != 0 {
+		t.Fatalf("ListTokens of user without tokens = %#v, want empty non-nil slice", tokens)
+	}
+
+	var created []iam.Token
+	for i := 0; i < 3; i++ {
+		created = append(created, mustCreateToken(t, database, alice.Id))
+		mustCreateToken(t, database, bob.Id)
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := database.RevokeToken(ctx, created[1].Id); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	created[1], err = database.GetToken(ctx, created[1].Id)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+
+	// Revoked tokens are listed, tokens of other users are not
+	tokens, err = database.ListTokens(ctx, alice.Id)
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if len(tokens) != len(created) {
+		t.Fatalf("ListTokens returned %d tokens, want %d", len(tokens), len(created))
+	}
+	for i := range created {
+		checkToken(t, tokens[i], created[i])
+	}
+
+	for _, userId := range []string{unknownId(alice.Id), "not-an-id"} {
+		tokens, err := database.ListTokens(ctx, userId)
+		if err != nil {
+			t.Errorf("ListTokens(%q): %v", userId, err)
+			continue
+		}
+		if tokens == nil || len(tokens) != 0 {
+			t.Errorf("ListTokens(%q) = %#v, want empty non-nil slice", userId, tokens)
+		}
+	}
+}
+
+// mustCreateUser creates user with a password hash derived from the username
+func mustCreateUser(t *testing.T, database db.Database, username string) iam.User {
+	t.Helper()
+	user, err := database.CreateUser(context.Background(), username, username+"-hash")
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+	return user
+}
+
+// mustCreateToken creates token of the user valid for an hour
+func mustCreateToken(t *testing.T, database db.Database, userId string) iam.Token {
+	t.Helper()
+	token, err := database.CreateToken(context.Background(), userId, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateToken(%q): %v", userId, err)
+	}
+	return token
+}
+
+// unknownId returns an identifier of the same format as id which is not
+// stored, so backends with typed identifiers can parse it
+func unknownId(id string) string {
+	b := []byte(id)
+	for i := len(b) - 1; i >= 0; i-- {
+		switch {
+		case b[i] >= '0' && b[i] <= '8', b[i] >= 'a' && b[i] <= 'e', b[i] >= 'A' && b[i] <= 'E':
+			b[i]++
+			return string(b)
+		case b[i] == '9' || b[i] == 'f' || b[i] == 'F':
+			b[i] = '0'
+			return string(b)
+		}
+	}
+	return id + "0"
+}
+
+func checkUser(t *testing.T, got, want iam.User) {
+	t.Helper()
+	if got.Id != want.Id || got.Username != want.Username || got.PasswordHash != want.PasswordHash ||
+		got.IsAdmin != want.IsAdmin || got.IsDisabled != want.IsDisabled ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("user = %s, want %s", formatUser(got), formatUser(want))
+	}
+}
+
+func formatUser(u iam.User) string {
+	return fmt.Sprintf("{Id:%s Username:%s PasswordHash:%s IsAdmin:%t IsDisabled:%t CreatedAt:%s UpdatedAt:%s}",
+		u.Id, u.Username, u.PasswordHash, u.IsAdmin, u.IsDisabled,
+		u.CreatedAt.UTC().Format(time.RFC3339Nano), u.UpdatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+func checkToken(t *testing.T, got, want iam.Token) {
+	t.Helper()
+	if got.Id != want.Id || got.UserId != want.UserId || got.IsRevoked != want.IsRevoked ||
+		!got.IssuedAt.Equal(want.IssuedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("token = %s, want %s", formatToken(got), formatToken(want))
+	}
+}
+
+func formatToken(tok iam.Token) string {
+	return fmt.Sprintf("{Id:%s UserId:%s IsRevoked:%t IssuedAt:%s ExpiresAt:%s UpdatedAt:%s}",
+		tok.Id, tok.UserId, tok.IsRevoked, tok.IssuedAt.UTC().Format(time.RFC3339Nano),
+		tok.ExpiresAt.UTC().Format(time.RFC3339Nano), tok.UpdatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// checkTimeBetween checks that timestamp set by the database is within the interval
+func checkTimeBetween(t *testing.T, name string, got, from, to time.Time) {
+	t.Helper()
+	if got.IsZero() {
+		t.Errorf("%s is zero", name)
+		return
+	}
+	if got.Before(from.Add(-timeSlack)) || got.After(to.Add(timeSlack)) {
+		t.Errorf("%s = %v, want between %v and %v", name, got, from, to)
+	}
+}
+
+// checkTimeEqual checks that stored timestamp equals the value up to storage precision
+func checkTimeEqual(t *testing.T, name string, got, want time.Time) {
+	t.Helper()
+	if d := got.Sub(want); d <= -timePrecision || d >= timePrecision {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
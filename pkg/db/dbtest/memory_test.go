@@ -0,0 +1,25 @@
+package dbtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/db/dbtest"
+	_ "github.com/kompotkot/tripidium/pkg/db/memory"
+)
+
+func TestMemory(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) db.Database {
+		database, err := db.CreateDatabase("memory", db.Options{})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+
+		if err := database.Migrate(context.Background()); err != nil {
+			t.Fatalf("failed to migrate database: %v", err)
+		}
+		return database
+	})
+}
@@ -0,0 +1,55 @@
+//go:build psql
+
+package dbtest_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/db/dbtest"
+	_ "github.com/kompotkot/tripidium/pkg/db/psql"
+)
+
+// psqlURIEnv names the variable with URI of a disposable PostgreSQL database,
+// the suite drops all tables of the schema
+const psqlURIEnv = "TRIPIDIUM_TEST_PSQL_URI"
+
+func TestPsql(t *testing.T) {
+	dbtest.Run(t, openPsql(t, db.PsqlOptions{}))
+}
+
+// TestPsqlReplica runs the suite with the database serving as its own read
+// replica, so reads go through replica routing
+func TestPsqlReplica(t *testing.T) {
+	uri := os.Getenv(psqlURIEnv)
+	dbtest.Run(t, openPsql(t, db.PsqlOptions{ReplicaURIs: []string{uri}}))
+}
+
+// openPsql returns function opening the database of psqlURIEnv with empty
+// migrated schema, the test is skipped if the variable is not set
+func openPsql(t *testing.T, opts db.PsqlOptions) dbtest.OpenFunc {
+	uri := os.Getenv(psqlURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", psqlURIEnv)
+	}
+
+	return func(t *testing.T) db.Database {
+		database, err := db.CreateDatabase("psql", db.Options{URI: uri, Psql: opts})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+
+		// Start from an empty schema, subtests share the database
+		ctx := context.Background()
+		if err := database.Rollback(ctx, 0); err != nil {
+			t.Fatalf("failed to reset database: %v", err)
+		}
+		if err := database.Migrate(ctx); err != nil {
+			t.Fatalf("failed to migrate database: %v", err)
+		}
+		return database
+	}
+}
@@ -0,0 +1,59 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+func testRateLimits(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	base := time.Now().Truncate(time.Second)
+
+	// set stores tat of the key and returns the previous value
+	set := func(key string, tat time.Time) time.Time {
+		t.Helper()
+		var prev time.Time
+		err := database.UpdateRateLimit(ctx, key, func(old time.Time) time.Time {
+			prev = old
+			return tat
+		})
+		if err != nil {
+			t.Fatalf("UpdateRateLimit(%q): %v", key, err)
+		}
+		return prev
+	}
+
+	if prev := set("a", base); !prev.IsZero() {
+		t.Errorf("state of unknown key = %v, want zero time", prev)
+	}
+	if prev := set("a", base.Add(time.Second)); !prev.Equal(base) {
+		t.Errorf("state = %v, want %v", prev, base)
+	}
+	set("b", base.Add(time.Hour))
+	set("c", base.Add(-time.Hour))
+
+	deleted, err := database.DeleteRateLimits(ctx, base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("DeleteRateLimits: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteRateLimits deleted %d states, want 2", deleted)
+	}
+
+	if prev := set("a", base); !prev.IsZero() {
+		t.Errorf("state of deleted key = %v, want zero time", prev)
+	}
+	if prev := set("b", base); !prev.Equal(base.Add(time.Hour)) {
+		t.Errorf("state of kept key = %v, want %v", prev, base.Add(time.Hour))
+	}
+
+	// Zero time is stored as unknown state
+	set("d", time.Time{})
+	if prev := set("d", base); !prev.IsZero() {
+		t.Errorf("state = %v, want zero time", prev)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build sqlite || sqlite_purego
+
+package dbtest_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/db/dbtest"
+	_ "github.com/kompotkot/tripidium/pkg/db/sqlite"
+)
+
+func TestSqlite(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) db.Database {
+		database, err := db.CreateDatabase("sqlite", db.Options{
+			URI: filepath.Join(t.TempDir(), "tripidium.db"),
+			Sqlite: db.SqliteOptions{
+				WAL:         true,
+				Synchronous: "NORMAL",
+				BusyTimeout: 5 * time.Second,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { database.Close() })
+
+		if err := database.Migrate(context.Background()); err != nil {
+			t.Fatalf("failed to migrate database: %v", err)
+		}
+		return database
+	})
+}
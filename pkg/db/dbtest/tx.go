@@ -0,0 +1,357 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// concurrency is a number of goroutines used by concurrency tests
+const concurrency = 8
+
+var errAbort = errors.New("abort transaction")
+
+func testWithTx(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	// Committed transaction keeps all changes and sees its own writes
+	var created iam.User
+	err := database.WithTx(ctx, func(tx db.Tx) error {
+		user, err := tx.CreateUser(ctx, "alice", "alice-hash")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.GetUser(ctx, user.Id, ""); err != nil {
+			return fmt.Errorf("read own write: %w", err)
+		}
+		isAdmin := true
+		if created, err = tx.UpdateUser(ctx, user.Id, db.UserUpdate{IsAdmin: &isAdmin}); err != nil {
+			return err
+		}
+		_, err = tx.CreateAuditEvent(ctx, iam.AuditEvent{Action: iam.AuditActionUserCreate, Target: user.Id, Result: iam.AuditResultSuccess})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	stored, err := database.GetUser(ctx, created.Id, "")
+	if err != nil {
+		t.Fatalf("GetUser of committed user: %v", err)
+	}
+	checkUser(t, stored, created)
+
+	// Error of the callback is returned as is and rolls back all changes
+	calls := 0
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		calls++
+		if _, err := tx.CreateUser(ctx, "bob", "bob-hash"); err != nil {
+			return err
+		}
+		if _, err := tx.CreateToken(ctx, created.Id, time.Now().Add(time.Hour)); err != nil {
+			return err
+		}
+		if _, err := tx.CreateAuditEvent(ctx, iam.AuditEvent{Action: iam.AuditActionSignUp, Result: iam.AuditResultSuccess}); err != nil {
+			return err
+		}
+		if err := tx.UpdateRateLimit(ctx, "bob", func(time.Time) time.Time { return time.Now() }); err != nil {
+			return err
+		}
+		return fmt.Errorf("wrapped: %w", errAbort)
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx: err = %v, want %v", err, errAbort)
+	}
+	if calls != 1 {
+		t.Errorf("callback failed with a permanent error was called %d times, want 1", calls)
+	}
+	if _, err := database.GetUser(ctx, "", "bob"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("GetUser of rolled back user: err = %v, want %v", err, db.ErrUserNotFound)
+	}
+	tokens, err := database.ListTokens(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("rolled back transaction left %d tokens", len(tokens))
+	}
+	err = database.UpdateRateLimit(ctx, "bob", func(tat time.Time) time.Time {
+		if !tat.IsZero() {
+			t.Errorf("rolled back transaction left rate limit state %v", tat)
+		}
+		return tat
+	})
+	if err != nil {
+		t.Fatalf("UpdateRateLimit: %v", err)
+	}
+
+	// Audit chain continues from the last committed event
+	events, err := database.ListAuditEvents(ctx, db.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("ListAuditEvents returned %d events, want 1", len(events))
+	}
+	next, err := database.CreateAuditEvent(ctx, iam.AuditEvent{Action: iam.AuditActionLogin, Result: iam.AuditResultSuccess})
+	if err != nil {
+		t.Fatalf("CreateAuditEvent: %v", err)
+	}
+	if next.PrevHash != events[0].Hash {
+		t.Errorf("PrevHash = %q, want hash of the last committed event %q", next.PrevHash, events[0].Hash)
+	}
+
+	// Sentinel errors are returned from the transaction too
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		_, err := tx.CreateUser(ctx, "alice", "other-hash")
+		return err
+	})
+	if !errors.Is(err, db.ErrUserAlreadyExists) {
+		t.Errorf("WithTx creating taken username: err = %v, want %v", err, db.ErrUserAlreadyExists)
+	}
+
+	// Read-only transaction can read
+	err = database.WithTx(ctx, func(tx db.Tx) error {
+		users, err := tx.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		if len(users) != 1 {
+			return fmt.Errorf("read-only transaction sees %d users, want 1", len(users))
+		}
+		return nil
+	}, db.WithReadOnly(), db.WithIsolation(db.IsolationSerializable))
+	if err != nil {
+		t.Errorf("read-only WithTx: %v", err)
+	}
+}
+
+func testConcurrency(t *testing.T, database db.Database) {
+	ctx := context.Background()
+
+	// run calls fn from concurrent goroutines and returns their errors
+	run := func(fn func(i int) error) []error {
+		errs := make([]error, concurrency)
+		var wg sync.WaitGroup
+		for i := range concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = fn(i)
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+
+	// Only one of users with the same username is created
+	errs := run(func(int) error {
+		_, err := database.CreateUser(ctx, "alice", "alice-hash")
+		return err
+	})
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, db.ErrUserAlreadyExists):
+			t.Errorf("concurrent CreateUser: err = %v, want nil or %v", err, db.ErrUserAlreadyExists)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d concurrent CreateUser with the same username succeeded, want 1", succeeded)
+	}
+
+	// Users with distinct usernames are all created
+	errs = run(func(i int) error {
+		_, err := database.CreateUser(ctx, fmt.Sprintf("user-%d", i), "hash")
+		return err
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent CreateUser: %v", err)
+		}
+	}
+	users, err := database.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != concurrency+1 {
+		t.Errorf("ListUsers returned %d users, want %d", len(users), concurrency+1)
+	}
+
+	// Rate limit updates of a key are not lost
+	base := time.Now().Truncate(time.Second)
+	errs = run(func(int) error {
+		return database.UpdateRateLimit(ctx, "key", func(tat time.Time) time.Time {
+			if tat.IsZero() {
+				tat = base
+			}
+			return tat.Add(time.Second)
+		})
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent UpdateRateLimit: %v", err)
+		}
+	}
+	err = database.UpdateRateLimit(ctx, "key", func(tat time.Time) time.Time {
+		if want := base.Add(concurrency * time.Second); !tat.Equal(want) {
+			t.Errorf("state after concurrent updates = %v, want %v", tat, want)
+		}
+		return tat
+	})
+	if err != nil {
+		t.Fatalf("UpdateRateLimit: %v", err)
+	}
+
+	// Concurrent audit events form a single chain
+	errs = run(func(i int) error {
+		_, err := database.CreateAuditEvent(ctx, iam.AuditEvent{
+			Actor:  fmt.Sprintf("user-%d", i),
+			Action: iam.AuditActionLogin,
+			Result: iam.AuditResultSuccess,
+		})
+		return err
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent CreateAuditEvent: %v", err)
+		}
+	}
+	events, err := database.ListAuditEvents(ctx, db.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if len(events) != concurrency {
+		t.Fatalf("ListAuditEvents returned %d events, want %d", len(events), concurrency)
+	}
+	prevHash := ""
+	for _, e := range events {
+		if e.PrevHash != prevHash {
+			t.Errorf("event %d PrevHash = %q, want %q", e.Id, e.PrevHash, prevHash)
+		}
+		if hash := e.ComputeHash(); hash != e.Hash {
+			t.Errorf("event %d hashes to %q, want %q", e.Id, hash, e.Hash)
+		}
+		prevHash = e.Hash
+	}
+
+	// Transactions changing the same user do not lose updates
+	user := users[0]
+	errs = run(func(int) error {
+		return database.WithTx(ctx, func(tx db.Tx) error {
+			if _, err := tx.CreateToken(ctx, user.Id, time.Now().Add(time.Hour)); err != nil {
+				return err
+			}
+			_, err := tx.UpdateUser(ctx, user.Id, db.UserUpdate{})
+			return err
+		}, db.WithIsolation(db.IsolationSerializable), db.WithMaxRetries(10))
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent WithTx: %v", err)
+		}
+	}
+	tokens, err := database.ListTokens(ctx, user.Id)
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if len(tokens) != concurrency {
+		t.Errorf("ListTokens returned %d tokens, want %d", len(tokens), concurrency)
+	}
+}
+
+func testContextCancellation(t *testing.T, database db.Database) {
+	user := mustCreateUser(t, database, "alice")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	contexts := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"canceled", canceled, context.Canceled},
+		{"expired", expired, context.DeadlineExceeded},
+	}
+
+	for _, c := range contexts {
+		ctx := c.ctx
+		calls := []struct {
+			name string
+			fn   func() error
+		}{
+			{"CreateUser", func() error { _, err := database.CreateUser(ctx, "bob", "bob-hash"); return err }},
+			{"GetUser", func() error { _, err := database.GetUser(ctx, user.Id, ""); return err }},
+			{"ListUsers", func() error { _, err := database.ListUsers(ctx); return err }},
+			{"UpdateUser", func() error { _, err := database.UpdateUser(ctx, user.Id, db.UserUpdate{}); return err }},
+			{"CreateToken", func() error { _, err := database.CreateToken(ctx, user.Id, time.Now().Add(time.Hour)); return err }},
+			{"ListTokens", func() error { _, err := database.ListTokens(ctx, user.Id); return err }},
+			{"CreateAuditEvent", func() error {
+				_, err := database.CreateAuditEvent(ctx, iam.AuditEvent{Action: iam.AuditActionLogin, Result: iam.AuditResultSuccess})
+				return err
+			}},
+			{"ListAuditEvents", func() error { _, err := database.ListAuditEvents(ctx, db.AuditEventFilter{}); return err }},
+			{"UpdateRateLimit", func() error {
+				return database.UpdateRateLimit(ctx, "key", func(time.Time) time.Time { return time.Now() })
+			}},
+			{"WithTx", func() error {
+				return database.WithTx(ctx, func(tx db.Tx) error {
+					_, err := tx.CreateUser(ctx, "bob", "bob-hash")
+					return err
+				})
+			}},
+		}
+
+		for _, call := range calls {
+			if err := call.fn(); !errors.Is(err, c.want) {
+				t.Errorf("%s with %s context: err = %v, want %v", call.name, c.name, err, c.want)
+			}
+		}
+	}
+
+	// Nothing was written by the failed calls
+	ctx := context.Background()
+	if _, err := database.GetUser(ctx, "", "bob"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("GetUser of user created with canceled context: err = %v, want %v", err, db.ErrUserNotFound)
+	}
+	tokens, err := database.ListTokens(ctx, user.Id)
+	if err != nil {
+		t.Fatalf("ListTokens: %v", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("calls with canceled context created %d tokens", len(tokens))
+	}
+	events, err := database.ListAuditEvents(ctx, db.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("calls with canceled context created %d audit events", len(events))
+	}
+
+	// Transaction is rolled back if its context is canceled before commit
+	txCtx, cancelTx := context.WithCancel(ctx)
+	err = database.WithTx(txCtx, func(tx db.Tx) error {
+		if _, err := tx.CreateUser(txCtx, "carol", "carol-hash"); err != nil {
+			return err
+		}
+		cancelTx()
+		return nil
+	})
+	if err == nil {
+		t.Error("WithTx canceled before commit succeeded")
+	}
+	if _, err := database.GetUser(ctx, "", "carol"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("GetUser of user created by canceled transaction: err = %v, want %v", err, db.ErrUserNotFound)
+	}
+}
@@ -8,3 +8,31 @@ var (
 	ErrUserNotFound          = errors.New("user not found")
 	ErrTokenNotFound         = errors.New("token not found")
 )
+
+// errorCodes maps sentinel errors to stable codes used in API error responses
+var errorCodes = map[error]string{
+	ErrUserAlreadyExists:     "user_already_exists",
+	ErrUnexpectedEmptyReturn: "unexpected_empty_return",
+	ErrUserNotFound:          "user_not_found",
+	ErrTokenNotFound:         "token_not_found",
+}
+
+// ErrorCode returns API error code of the sentinel error wrapped by err or empty string
+func ErrorCode(err error) string {
+	for sentinel, code := range errorCodes {
+		if errors.Is(err, sentinel) {
+			return code
+		}
+	}
+	return ""
+}
+
+// ErrorFromCode returns sentinel error of the API error code or nil if code is unknown
+func ErrorFromCode(code string) error {
+	for sentinel, c := range errorCodes {
+		if c == code {
+			return sentinel
+		}
+	}
+	return nil
+}
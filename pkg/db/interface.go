@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/kompotkot/tripidium/pkg/iam"
 )
@@ -14,12 +15,83 @@ type Database interface {
 	// Close closes the database connection
 	Close() error
 
+	// Migrate applies pending schema migrations
+	Migrate(ctx context.Context) error
+
+	// SchemaVersion returns applied schema version and the latest version known to the implementation
+	SchemaVersion(ctx context.Context) (current int, latest int, err error)
+
+	// Rollback reverts applied migrations newer than version in reverse order
+	Rollback(ctx context.Context, version int) error
+
+	// Migrations returns schema migrations known to the implementation in order of application
+	Migrations() []Migration
+
+	// WithTx runs fn in a transaction, it is committed if fn returns nil and
+	// rolled back otherwise. Attempts failed by a serialization conflict or a
+	// locked database are retried, so fn must be safe to run again.
+	WithTx(ctx context.Context, fn func(tx Tx) error, opts ...TxOption) error
+
+	Tx
+}
+
+// Tx holds data operations, Database runs each of them on its own and Tx
+// passed to WithTx callback runs them in the transaction
+type Tx interface {
 	// CreateUser creates new user in database
 	CreateUser(ctx context.Context, username string, passwordHash string) (iam.User, error)
 
 	// GetUser retrieves a user from the database
 	GetUser(ctx context.Context, userId, username string) (iam.User, error)
 
+	// ListUsers retrieves all users ordered by username
+	ListUsers(ctx context.Context) ([]iam.User, error)
+
+	// UpdateUser changes fields set in the update and returns the updated user
+	UpdateUser(ctx context.Context, userId string, update UserUpdate) (iam.User, error)
+
 	// GetToken retrieves a token from the database
 	GetToken(ctx context.Context, tokenId string) (iam.Token, error)
+
+	// CreateToken issues new token for the user valid until expiresAt
+	CreateToken(ctx context.Context, userId string, expiresAt time.Time) (iam.Token, error)
+
+	// RevokeToken marks token as revoked
+	RevokeToken(ctx context.Context, tokenId string) error
+
+	// ListTokens retrieves tokens of the user ordered by issue time
+	ListTokens(ctx context.Context, userId string) ([]iam.Token, error)
+
+	// CreateAuditEvent appends event to the audit log chaining it to the last stored event
+	CreateAuditEvent(ctx context.Context, event iam.AuditEvent) (iam.AuditEvent, error)
+
+	// ListAuditEvents retrieves audit events matching the filter ordered by Id
+	ListAuditEvents(ctx context.Context, filter AuditEventFilter) ([]iam.AuditEvent, error)
+
+	// UpdateRateLimit atomically replaces rate limit state of the key, which is
+	// theoretical arrival time of the next request, with the value returned by
+	// update, zero time is passed for unknown keys
+	UpdateRateLimit(ctx context.Context, key string, update func(tat time.Time) time.Time) error
+
+	// DeleteRateLimits removes rate limit states with arrival time before the time
+	DeleteRateLimits(ctx context.Context, before time.Time) (int64, error)
+}
+
+// UserUpdate lists user fields to change, nil fields are kept
+type UserUpdate struct {
+	PasswordHash *string
+	IsAdmin      *bool
+	IsDisabled   *bool
+}
+
+// AuditEventFilter narrows down audit events query, empty fields are ignored
+type AuditEventFilter struct {
+	Actor   string
+	Action  string
+	Target  string
+	Result  string
+	Since   time.Time
+	Until   time.Time
+	AfterId int64
+	Limit   int
 }
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// CreateAuditEvent appends event to the audit log chaining it to the last stored event
+func (m *MemoryDB) CreateAuditEvent(ctx context.Context, event iam.AuditEvent) (iam.AuditEvent, error) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	// Keep precision of SQL backends, so snapshots and hashes match them
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	err := m.write(ctx, func(d *data) error {
+		event.Id = 1
+		event.PrevHash = ""
+		if n := len(d.auditEvents); n > 0 {
+			event.Id = d.auditEvents[n-1].Id + 1
+			event.PrevHash = d.auditEvents[n-1].Hash
+		}
+		event.Hash = event.ComputeHash()
+
+		d.auditEvents = append(d.auditEvents, event)
+		return nil
+	})
+	if err != nil {
+		return iam.AuditEvent{}, err
+	}
+
+	return event, nil
+}
+
+// ListAuditEvents retrieves audit events matching the filter ordered by Id
+func (m *MemoryDB) ListAuditEvents(ctx context.Context, filter db.AuditEventFilter) ([]iam.AuditEvent, error) {
+	events := []iam.AuditEvent{}
+	err := m.read(ctx, func(d *data) error {
+		for _, e := range d.auditEvents {
+			if filter.Limit > 0 && len(events) >= filter.Limit {
+				break
+			}
+			if matchAuditEvent(e, filter) {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// matchAuditEvent reports whether event passes the filter
+func matchAuditEvent(e iam.AuditEvent, filter db.AuditEventFilter) bool {
+	switch {
+	case filter.Actor != "" && e.Actor != filter.Actor,
+		filter.Action != "" && e.Action != filter.Action,
+		filter.Target != "" && e.Target != filter.Target,
+		filter.Result != "" && e.Result != filter.Result,
+		!filter.Since.IsZero() && e.CreatedAt.Before(filter.Since),
+		!filter.Until.IsZero() && !e.CreatedAt.Before(filter.Until),
+		e.Id <= filter.AfterId:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+package memory
+
+import (
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// Factory implements DatabaseFactory for the memory database
+type Factory struct{}
+
+// NewFactory creates a new memory database factory
+func NewFactory() db.DatabaseFactory {
+	return &Factory{}
+}
+
+// Create creates a new memory database, URI is the optional snapshot file
+func (f *Factory) Create(opts db.Options) (db.Database, error) {
+	return NewMemoryDB(opts.URI)
+}
+
+// GetType returns the database type
+func (f *Factory) GetType() string {
+	return "memory"
+}
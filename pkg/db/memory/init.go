@@ -0,0 +1,10 @@
+package memory
+
+import (
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+func init() {
+	// Register memory factory when this package is imported
+	db.RegisterDatabase(NewFactory())
+}
@@ -0,0 +1,358 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+var (
+	ErrClosed      = errors.New("memory database is closed")
+	ErrNotMigrated = errors.New("memory database schema is not migrated")
+	ErrReadOnly    = errors.New("write in read-only transaction")
+)
+
+// MemoryDB keeps data in process memory, it is safe for concurrent use. Data
+// is lost on exit unless the database has a snapshot file.
+type MemoryDB struct {
+	store *store
+	// tx is set for the value passed to WithTx callback, the callback holds
+	// the lock of the store
+	tx       *data
+	readOnly bool
+}
+
+// store holds data shared by the database and values passed to WithTx callbacks
+type store struct {
+	mu     sync.RWMutex
+	data   *data
+	closed bool
+	// dirty is set if data changed since it was loaded or written to the snapshot file
+	dirty bool
+
+	// path is the snapshot file, empty if data is not persisted
+	path string
+	// snapshotMu serializes snapshot writers
+	snapshotMu sync.Mutex
+}
+
+// data is the content of the database, transactions change its copy
+type data struct {
+	version     int
+	users       map[string]iam.User
+	usernames   map[string]string // username to user Id
+	tokens      map[string]iam.Token
+	auditEvents []iam.AuditEvent
+	rateLimits  map[string]time.Time
+}
+
+// NewMemoryDB creates a new in-memory database. If path is set, data is
+// loaded from the snapshot file if it exists and written back on Close.
+func NewMemoryDB(path string) (*MemoryDB, error) {
+	d, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryDB{store: &store{data: d, path: path}}, nil
+}
+
+// newData returns empty data of schema version 0
+func newData() *data {
+	return &data{
+		users:      map[string]iam.User{},
+		usernames:  map[string]string{},
+		tokens:     map[string]iam.Token{},
+		rateLimits: map[string]time.Time{},
+	}
+}
+
+// clone returns a copy of data changed by a transaction
+func (d *data) clone() *data {
+	return &data{
+		version:   d.version,
+		users:     maps.Clone(d.users),
+		usernames: maps.Clone(d.usernames),
+		tokens:    maps.Clone(d.tokens),
+		// Clip, so appends of the transaction do not touch the backing array
+		auditEvents: slices.Clip(d.auditEvents),
+		rateLimits:  maps.Clone(d.rateLimits),
+	}
+}
+
+// TestConnection reports whether the database is open
+func (m *MemoryDB) TestConnection(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	if m.store.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close writes the snapshot file and rejects further operations
+func (m *MemoryDB) Close() error {
+	return m.store.save(true)
+}
+
+// read runs fn with data of the transaction or under the read lock
+func (m *MemoryDB) read(ctx context.Context, fn func(d *data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.tx != nil {
+		return fn(m.tx)
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	if err := m.store.check(); err != nil {
+		return err
+	}
+	return fn(m.store.data)
+}
+
+// write runs fn with data of the transaction or under the write lock, fn
+// must not change data if it fails
+func (m *MemoryDB) write(ctx context.Context, fn func(d *data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.tx != nil {
+		if m.readOnly {
+			return ErrReadOnly
+		}
+		return fn(m.tx)
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if err := m.store.check(); err != nil {
+		return err
+	}
+	if err := fn(m.store.data); err != nil {
+		return err
+	}
+	m.store.dirty = true
+	return nil
+}
+
+// check reports whether data may be accessed, the lock must be held
+func (s *store) check() error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.data.version < latestVersion() {
+		return ErrNotMigrated
+	}
+	return nil
+}
+
+// CreateUser creates new user in database
+func (m *MemoryDB) CreateUser(ctx context.Context, username, passwordHash string) (iam.User, error) {
+	var user iam.User
+	err := m.write(ctx, func(d *data) error {
+		if _, exists := d.usernames[username]; exists {
+			return db.ErrUserAlreadyExists
+		}
+
+		now := now()
+		user = iam.User{
+			Id:           newId(),
+			Username:     username,
+			PasswordHash: passwordHash,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		d.users[user.Id] = user
+		d.usernames[username] = user.Id
+		return nil
+	})
+	if err != nil {
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetUser retrieves user from the database by it's Id or Username, at least one of them must be set
+func (m *MemoryDB) GetUser(ctx context.Context, userId, username string) (iam.User, error) {
+	var user iam.User
+	err := m.read(ctx, func(d *data) error {
+		if userId == "" {
+			userId = d.usernames[username]
+		}
+
+		var ok bool
+		user, ok = d.users[userId]
+		if !ok || (username != "" && user.Username != username) {
+			return db.ErrUserNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// ListUsers retrieves all users ordered by username
+func (m *MemoryDB) ListUsers(ctx context.Context) ([]iam.User, error) {
+	users := []iam.User{}
+	err := m.read(ctx, func(d *data) error {
+		for _, user := range d.users {
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(users, func(a, b iam.User) int {
+		return cmp.Compare(a.Username, b.Username)
+	})
+	return users, nil
+}
+
+// UpdateUser changes fields set in the update and returns the updated user
+func (m *MemoryDB) UpdateUser(ctx context.Context, userId string, update db.UserUpdate) (iam.User, error) {
+	var user iam.User
+	err := m.write(ctx, func(d *data) error {
+		var ok bool
+		user, ok = d.users[userId]
+		if !ok {
+			return db.ErrUserNotFound
+		}
+
+		if update.PasswordHash != nil {
+			user.PasswordHash = *update.PasswordHash
+		}
+		if update.IsAdmin != nil {
+			user.IsAdmin = *update.IsAdmin
+		}
+		if update.IsDisabled != nil {
+			user.IsDisabled = *update.IsDisabled
+		}
+		user.UpdatedAt = now()
+
+		d.users[userId] = user
+		return nil
+	})
+	if err != nil {
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetToken retrieves a token from the database
+func (m *MemoryDB) GetToken(ctx context.Context, tokenId string) (iam.Token, error) {
+	var token iam.Token
+	err := m.read(ctx, func(d *data) error {
+		var ok bool
+		if token, ok = d.tokens[tokenId]; !ok {
+			return db.ErrTokenNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return iam.Token{}, err
+	}
+
+	return token, nil
+}
+
+// CreateToken issues new token for the user valid until expiresAt
+func (m *MemoryDB) CreateToken(ctx context.Context, userId string, expiresAt time.Time) (iam.Token, error) {
+	var token iam.Token
+	err := m.write(ctx, func(d *data) error {
+		if _, ok := d.users[userId]; !ok {
+			return db.ErrUserNotFound
+		}
+
+		now := now()
+		token = iam.Token{
+			Id:        newId(),
+			UserId:    userId,
+			IssuedAt:  now,
+			ExpiresAt: expiresAt.UTC(),
+			UpdatedAt: now,
+		}
+		d.tokens[token.Id] = token
+		return nil
+	})
+	if err != nil {
+		return iam.Token{}, err
+	}
+
+	return token, nil
+}
+
+// ListTokens retrieves tokens of the user ordered by issue time
+func (m *MemoryDB) ListTokens(ctx context.Context, userId string) ([]iam.Token, error) {
+	tokens := []iam.Token{}
+	err := m.read(ctx, func(d *data) error {
+		for _, token := range d.tokens {
+			if token.UserId == userId {
+				tokens = append(tokens, token)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(tokens, func(a, b iam.Token) int {
+		if c := a.IssuedAt.Compare(b.IssuedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return tokens, nil
+}
+
+// RevokeToken marks token as revoked
+func (m *MemoryDB) RevokeToken(ctx context.Context, tokenId string) error {
+	return m.write(ctx, func(d *data) error {
+		token, ok := d.tokens[tokenId]
+		if !ok {
+			return db.ErrTokenNotFound
+		}
+
+		token.IsRevoked = true
+		token.UpdatedAt = now()
+		d.tokens[tokenId] = token
+		return nil
+	})
+}
+
+// newId returns a random identifier in the format of SQLite backend
+func newId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// now returns current time without monotonic clock reading
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// migrations lists schema versions of the memory database, data has no
+// schema to change, so migrations only move the version
+var migrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "initial",
+	},
+}
+
+// latestVersion returns version of the last migration
+func latestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate moves schema to the latest version
+func (m *MemoryDB) Migrate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if m.store.closed {
+		return ErrClosed
+	}
+	if m.store.data.version < latestVersion() {
+		m.store.data.version = latestVersion()
+		m.store.dirty = true
+	}
+	return nil
+}
+
+// SchemaVersion returns applied schema version and the latest version known
+// to the implementation, version is 0 before the first migration
+func (m *MemoryDB) SchemaVersion(ctx context.Context) (int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, latestVersion(), err
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	if m.store.closed {
+		return 0, latestVersion(), ErrClosed
+	}
+	return m.store.data.version, latestVersion(), nil
+}
+
+// Rollback moves schema back to the version, all data is removed if it
+// goes before the first migration
+func (m *MemoryDB) Rollback(ctx context.Context, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if m.store.closed {
+		return ErrClosed
+	}
+	if version >= m.store.data.version {
+		return nil
+	}
+
+	if version < migrations[0].Version {
+		m.store.data = newData()
+	} else {
+		m.store.data.version = version
+	}
+	m.store.dirty = true
+	return nil
+}
+
+// Migrations returns schema migrations known to the implementation in order of application
+func (m *MemoryDB) Migrations() []db.Migration {
+	return migrations
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+// UpdateRateLimit atomically replaces rate limit state of the key with the value returned by update
+func (m *MemoryDB) UpdateRateLimit(ctx context.Context, key string, update func(tat time.Time) time.Time) error {
+	return m.write(ctx, func(d *data) error {
+		d.rateLimits[key] = update(d.rateLimits[key])
+		return nil
+	})
+}
+
+// DeleteRateLimits removes rate limit states with arrival time before the time
+func (m *MemoryDB) DeleteRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := m.write(ctx, func(d *data) error {
+		for key, tat := range d.rateLimits {
+			if tat.Before(before) {
+				delete(d.rateLimits, key)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// snapshot is the content of the snapshot file
+type snapshot struct {
+	Version     int                  `json:"version"`
+	Users       []iam.User           `json:"users"`
+	Tokens      []iam.Token          `json:"tokens"`
+	AuditEvents []iam.AuditEvent     `json:"audit_events"`
+	RateLimits  map[string]time.Time `json:"rate_limits"`
+}
+
+// Snapshot writes data to the snapshot file if it changed since the last
+// write, it does nothing for a database without the file
+func (m *MemoryDB) Snapshot() error {
+	return m.store.save(false)
+}
+
+// save writes data to the snapshot file if it changed, close marks the store
+// closed in the same critical section, so no change is lost
+func (s *store) save(close bool) error {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		if close {
+			return nil
+		}
+		return ErrClosed
+	}
+	s.closed = close
+	if s.path == "" || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	snap := s.data.snapshot()
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err := writeSnapshot(s.path, snap); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return fmt.Errorf("failed to write snapshot %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// snapshot copies data, so it can be encoded without the lock
+func (d *data) snapshot() snapshot {
+	snap := snapshot{
+		Version: d.version,
+		Users:   make([]iam.User, 0, len(d.users)),
+		Tokens:  make([]iam.Token, 0, len(d.tokens)),
+		// Events are append-only, so the slice may be shared
+		AuditEvents: d.auditEvents,
+		RateLimits:  make(map[string]time.Time, len(d.rateLimits)),
+	}
+	for _, user := range d.users {
+		snap.Users = append(snap.Users, user)
+	}
+	for _, token := range d.tokens {
+		snap.Tokens = append(snap.Tokens, token)
+	}
+	for key, tat := range d.rateLimits {
+		snap.RateLimits[key] = tat
+	}
+	return snap
+}
+
+// writeSnapshot replaces the file atomically, it holds password hashes, so
+// it is readable by the owner only
+func writeSnapshot(path string, snap snapshot) error {
+	content, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// loadSnapshot reads data from the snapshot file, missing file or empty path
+// give empty data
+func loadSnapshot(path string) (*data, error) {
+	d := newData()
+	if path == "" {
+		return d, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return d, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(content, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+
+	d.version = snap.Version
+	for _, user := range snap.Users {
+		if _, exists := d.usernames[user.Username]; exists {
+			return nil, fmt.Errorf("invalid snapshot %s: duplicate username %s", path, user.Username)
+		}
+		d.users[user.Id] = user
+		d.usernames[user.Username] = user.Id
+	}
+	for _, token := range snap.Tokens {
+		d.tokens[token.Id] = token
+	}
+	d.auditEvents = snap.AuditEvents
+	for key, tat := range snap.RateLimits {
+		d.rateLimits[key] = tat
+	}
+
+	return d, nil
+}
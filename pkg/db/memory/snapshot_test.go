@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tripidium.json")
+
+	database, err := NewMemoryDB(path)
+	if err != nil {
+		t.Fatalf("NewMemoryDB: %v", err)
+	}
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	user, err := database.CreateUser(ctx, "alice", "alice-hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token, err := database.CreateToken(ctx, user.Id, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	event, err := database.CreateAuditEvent(ctx, iam.AuditEvent{Action: iam.AuditActionSignUp, Result: iam.AuditResultSuccess})
+	if err != nil {
+		t.Fatalf("CreateAuditEvent: %v", err)
+	}
+	tat := time.Now().Add(time.Minute).UTC()
+	if err := database.UpdateRateLimit(ctx, "key", func(time.Time) time.Time { return tat }); err != nil {
+		t.Fatalf("UpdateRateLimit: %v", err)
+	}
+
+	if err := database.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("snapshot file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("snapshot file permissions = %o, want 600", perm)
+	}
+
+	// Changes after the snapshot are written on Close
+	isAdmin := true
+	if user, err = database.UpdateUser(ctx, user.Id, db.UserUpdate{IsAdmin: &isAdmin}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if err := database.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := database.GetUser(ctx, user.Id, ""); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetUser after Close: err = %v, want %v", err, ErrClosed)
+	}
+
+	reopened, err := NewMemoryDB(path)
+	if err != nil {
+		t.Fatalf("NewMemoryDB from snapshot: %v", err)
+	}
+	defer reopened.Close()
+
+	current, latest, err := reopened.SchemaVersion(ctx)
+	if err != nil || current != latest {
+		t.Fatalf("SchemaVersion = %d, %d, %v, want migrated schema", current, latest, err)
+	}
+
+	stored, err := reopened.GetUser(ctx, "", "alice")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if stored.Id != user.Id || stored.PasswordHash != user.PasswordHash || !stored.IsAdmin || !stored.UpdatedAt.Equal(user.UpdatedAt) {
+		t.Errorf("restored user = %+v, want %+v", stored, user)
+	}
+
+	storedToken, err := reopened.GetToken(ctx, token.Id)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if storedToken != token {
+		t.Errorf("restored token = %+v, want %+v", storedToken, token)
+	}
+
+	events, err := reopened.ListAuditEvents(ctx, db.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if len(events) != 1 || events[0] != event {
+		t.Errorf("restored audit events = %+v, want [%+v]", events, event)
+	}
+
+	// Usernames are indexed again
+	if _, err := reopened.CreateUser(ctx, "alice", "other-hash"); !errors.Is(err, db.ErrUserAlreadyExists) {
+		t.Errorf("CreateUser with restored username: err = %v, want %v", err, db.ErrUserAlreadyExists)
+	}
+
+	err = reopened.UpdateRateLimit(ctx, "key", func(got time.Time) time.Time {
+		if !got.Equal(tat) {
+			t.Errorf("restored rate limit state = %v, want %v", got, tat)
+		}
+		return got
+	})
+	if err != nil {
+		t.Fatalf("UpdateRateLimit: %v", err)
+	}
+}
+
+func TestNotMigrated(t *testing.T) {
+	database, err := NewMemoryDB("")
+	if err != nil {
+		t.Fatalf("NewMemoryDB: %v", err)
+	}
+	defer database.Close()
+
+	if _, err := database.ListUsers(context.Background()); !errors.Is(err, ErrNotMigrated) {
+		t.Errorf("ListUsers before Migrate: err = %v, want %v", err, ErrNotMigrated)
+	}
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// WithTx runs fn in a transaction holding the lock of the database, so
+// transactions are serializable and never retried. fn changes a copy of the
+// data which replaces it on commit, so fn must not use the database itself.
+// Writes in a read-only transaction fail with ErrReadOnly.
+func (m *MemoryDB) WithTx(ctx context.Context, fn func(tx db.Tx) error, opts ...db.TxOption) error {
+	o := db.NewTxOptions(opts...)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if o.ReadOnly {
+		m.store.mu.RLock()
+		defer m.store.mu.RUnlock()
+
+		if err := m.store.check(); err != nil {
+			return err
+		}
+		return fn(&MemoryDB{store: m.store, tx: m.store.data, readOnly: true})
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if err := m.store.check(); err != nil {
+		return err
+	}
+
+	tx := m.store.data.clone()
+	if err := fn(&MemoryDB{store: m.store, tx: tx}); err != nil {
+		return err
+	}
+
+	// Canceled transaction is rolled back like in SQL backends
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.store.data = tx
+	m.store.dirty = true
+	return nil
+}
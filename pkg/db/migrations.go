@@ -0,0 +1,9 @@
+package db
+
+// Migration represents a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
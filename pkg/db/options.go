@@ -0,0 +1,48 @@
+package db
+
+import "time"
+
+// Options configure a database connection, backends read the common
+// settings and their own section, zero values keep defaults of the backend
+type Options struct {
+	URI    string
+	Pool   PoolOptions
+	Sqlite SqliteOptions
+	Psql   PsqlOptions
+}
+
+// PoolOptions holds connection pool settings common to backends
+type PoolOptions struct {
+	MaxConns        int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// SqliteOptions holds SQLite pragmas applied to every connection
+type SqliteOptions struct {
+	// WAL enables write-ahead log journal mode
+	WAL bool
+	// Synchronous is one of OFF, NORMAL, FULL, EXTRA
+	Synchronous string
+	// BusyTimeout is how long a locked database is retried
+	BusyTimeout time.Duration
+	// CacheSize is the page cache size, pages if positive, KiB if negative
+	CacheSize int
+	// MmapSize is the maximum number of bytes of the file mapped to memory
+	MmapSize int64
+	// ReadOnly rejects writes, the schema must be migrated beforehand
+	ReadOnly bool
+}
+
+// PsqlOptions holds PostgreSQL pool and session settings
+type PsqlOptions struct {
+	MinConns          int
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
+	StatementTimeout  time.Duration
+	ApplicationName   string
+	// ReplicaURIs are read replicas serving reads outside transactions
+	ReplicaURIs []string
+	// ReplicaCheckPeriod is the interval of replica health checks
+	ReplicaCheckPeriod time.Duration
+}
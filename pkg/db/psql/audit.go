@@ -0,0 +1,145 @@
+//go:build psql
+
+package psql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	db "github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// auditEventsLockId is a key of advisory lock serializing audit log writers
+const auditEventsLockId int64 = 7_341_202
+
+// CreateAuditEvent appends event to the audit log chaining it to the last stored event
+func (p *PsqlDB) CreateAuditEvent(ctx context.Context, event iam.AuditEvent) (iam.AuditEvent, error) {
+	const query = `
+		INSERT INTO audit_events (actor, action, target, ip, user_agent, request_id, result, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+
+	// Inside WithTx this is a savepoint and the lock below is held until the outer transaction ends
+	tx, err := p.q.Begin(ctx)
+	if err != nil {
+		return iam.AuditEvent{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize writers, so each event is chained to the latest one
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditEventsLockId); err != nil {
+		return iam.AuditEvent{}, err
+	}
+
+	var prevHash string
+	err = tx.QueryRow(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return iam.AuditEvent{}, err
+	}
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	// PostgreSQL keeps microseconds, hash must match the stored value
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+	event.PrevHash = prevHash
+	event.Hash = event.ComputeHash()
+
+	err = tx.QueryRow(ctx, query,
+		event.Actor, event.Action, event.Target, event.IP, event.UserAgent, event.RequestId,
+		event.Result, event.CreatedAt, event.PrevHash, event.Hash,
+	).Scan(&event.Id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return iam.AuditEvent{}, db.ErrUnexpectedEmptyReturn
+		}
+
+		return iam.AuditEvent{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return iam.AuditEvent{}, err
+	}
+
+	return event, nil
+}
+
+// ListAuditEvents retrieves audit events matching the filter ordered by Id
+func (p *PsqlDB) ListAuditEvents(ctx context.Context, filter db.AuditEventFilter) ([]iam.AuditEvent, error) {
+	var sb strings.Builder
+	args := make([]interface{}, 0, 8)
+
+	sb.WriteString(`SELECT id, actor, action, target, ip, user_agent, request_id, result, created_at, prev_hash, hash FROM audit_events `)
+
+	sep := " WHERE "
+	addCondition := func(cond string, arg interface{}) {
+		sb.WriteString(sep)
+		args = append(args, arg)
+		sb.WriteString(fmt.Sprintf(cond, len(args)))
+		sep = " AND "
+	}
+
+	if filter.Actor != "" {
+		addCondition("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if filter.Target != "" {
+		addCondition("target = $%d", filter.Target)
+	}
+	if filter.Result != "" {
+		addCondition("result = $%d", filter.Result)
+	}
+	if !filter.Since.IsZero() {
+		addCondition("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		addCondition("created_at < $%d", filter.Until)
+	}
+	if filter.AfterId > 0 {
+		addCondition("id > $%d", filter.AfterId)
+	}
+
+	sb.WriteString(" ORDER BY id")
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		sb.WriteString(fmt.Sprintf(" LIMIT $%d", len(args)))
+	}
+
+	var events []iam.AuditEvent
+	err := p.read(ctx, func(q querier) error {
+		rows, err := q.Query(ctx, sb.String(), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		events = []iam.AuditEvent{}
+		for rows.Next() {
+			var e iam.AuditEvent
+			if err := rows.Scan(
+				&e.Id, &e.Actor, &e.Action, &e.Target, &e.IP, &e.UserAgent, &e.RequestId,
+				&e.Result, &e.CreatedAt, &e.PrevHash, &e.Hash,
+			); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
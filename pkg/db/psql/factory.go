@@ -3,8 +3,6 @@
 package psql
 
 import (
-	"time"
-
 	"github.com/kompotkot/tripidium/pkg/db"
 )
 
@@ -17,8 +15,8 @@ func NewFactory() db.DatabaseFactory {
 }
 
 // Create creates a new PostgreSQL database connection
-func (f *Factory) Create(uri string, maxConns int, connMaxLifetime int64) (db.Database, error) {
-	return NewPsqlDB(uri, maxConns, time.Duration(connMaxLifetime))
+func (f *Factory) Create(opts db.Options) (db.Database, error) {
+	return NewPsqlDB(opts.URI, opts.Pool, opts.Psql)
 }
 
 // GetType returns the database type
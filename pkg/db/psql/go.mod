@@ -2,6 +2,8 @@ module github.com/kompotkot/tripidium/pkg/db/psql
 
 go 1.25.1
 
+replace github.com/kompotkot/tripidium => ../../..
+
 require (
 	github.com/jackc/pgx/v5 v5.7.6
 	github.com/kompotkot/tripidium v0.0.0-20251028111051-344401a7a521
@@ -11,7 +13,7 @@ require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
-	golang.org/x/crypto v0.37.0 // indirect
-	golang.org/x/sync v0.13.0 // indirect
-	golang.org/x/text v0.24.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/sync v0.22.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 )
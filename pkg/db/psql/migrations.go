@@ -0,0 +1,230 @@
+//go:build psql
+
+package psql
+
+import (
+	"context"
+	"fmt"
+
+	db "github.com/kompotkot/tripidium/pkg/db"
+)
+
+// migrationsLockId is a key of advisory lock taken while applying migrations
+const migrationsLockId int64 = 7_341_201
+
+// migrations lists PostgreSQL schema changes in order of application
+var migrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "users_tokens",
+		Up: `
+			CREATE TABLE IF NOT EXISTS users (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				username VARCHAR(256) NOT NULL UNIQUE,
+				password_hash VARCHAR(256) NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			);
+
+			CREATE TABLE IF NOT EXISTS tokens (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				is_revoked BOOLEAN NOT NULL DEFAULT false,
+				issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+				expires_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			);
+
+			CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS tokens;
+			DROP TABLE IF EXISTS users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "users_is_admin",
+		Up:      `ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;`,
+		Down:    `ALTER TABLE users DROP COLUMN IF EXISTS is_admin;`,
+	},
+	{
+		Version: 3,
+		Name:    "audit_events",
+		Up: `
+			CREATE TABLE audit_events (
+				id BIGSERIAL PRIMARY KEY,
+				actor VARCHAR(256) NOT NULL DEFAULT '',
+				action VARCHAR(128) NOT NULL,
+				target VARCHAR(256) NOT NULL DEFAULT '',
+				ip VARCHAR(64) NOT NULL DEFAULT '',
+				user_agent TEXT NOT NULL DEFAULT '',
+				request_id VARCHAR(128) NOT NULL DEFAULT '',
+				result VARCHAR(32) NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+				hash VARCHAR(64) NOT NULL UNIQUE
+			);
+
+			CREATE INDEX audit_events_actor_idx ON audit_events (actor);
+			CREATE INDEX audit_events_action_idx ON audit_events (action);
+			CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+			CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit_events is append-only';
+			END;
+			$$ LANGUAGE plpgsql;
+
+			CREATE TRIGGER audit_events_append_only
+				BEFORE UPDATE OR DELETE ON audit_events
+				FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+		`,
+		Down: `
+			DROP TABLE IF EXISTS audit_events;
+			DROP FUNCTION IF EXISTS audit_events_append_only();
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "rate_limits",
+		Up: `
+			CREATE TABLE rate_limits (
+				key VARCHAR(512) PRIMARY KEY,
+				tat BIGINT NOT NULL
+			);
+
+			CREATE INDEX rate_limits_tat_idx ON rate_limits (tat);
+		`,
+		Down: `DROP TABLE IF EXISTS rate_limits;`,
+	},
+	{
+		Version: 5,
+		Name:    "users_is_disabled",
+		Up:      `ALTER TABLE users ADD COLUMN IF NOT EXISTS is_disabled BOOLEAN NOT NULL DEFAULT false;`,
+		Down:    `ALTER TABLE users DROP COLUMN IF EXISTS is_disabled;`,
+	},
+}
+
+// Migrate applies pending schema migrations
+func (p *PsqlDB) Migrate(ctx context.Context) error {
+	const query = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(256) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`
+
+	if _, err := p.pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		if err := p.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// SchemaVersion returns applied schema version and the latest version known
+// to the implementation, version is 0 before the first migration
+func (p *PsqlDB) SchemaVersion(ctx context.Context) (int, int, error) {
+	latest := migrations[len(migrations)-1].Version
+
+	var exists bool
+	if err := p.pool.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, latest, err
+	}
+	if !exists {
+		return 0, latest, nil
+	}
+
+	var current int
+	err := p.pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return 0, latest, err
+	}
+
+	return current, latest, nil
+}
+
+// applyMigration runs migration in a transaction if it was not applied yet
+func (p *PsqlDB) applyMigration(ctx context.Context, m db.Migration) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Prevent concurrent instances from applying the same migration
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockId); err != nil {
+		return err
+	}
+
+	var applied bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", m.Version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, m.Up); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Rollback reverts applied migrations newer than version in reverse order
+func (p *PsqlDB) Rollback(ctx context.Context, version int) error {
+	for i := len(migrations) - 1; i >= 0 && migrations[i].Version > version; i-- {
+		m := migrations[i]
+		if err := p.revertMigration(ctx, m); err != nil {
+			return fmt.Errorf("failed to revert migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Migrations returns schema migrations known to the implementation in order of application
+func (p *PsqlDB) Migrations() []db.Migration {
+	return migrations
+}
+
+// revertMigration runs down migration in a transaction if it was applied
+func (p *PsqlDB) revertMigration(ctx context.Context, m db.Migration) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Prevent concurrent instances from changing schema at the same time
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockId); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, m.Down); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,19 +21,102 @@ import (
 // PsqlDB represents a PostgreSQL database connection
 type PsqlDB struct {
 	pool *pgxpool.Pool
+	// q runs data queries, it is the transaction inside WithTx
+	q querier
+	// replicas serve reads outside transactions, nil if there are no replicas
+	replicas *replicaSet
 }
 
-// NewPsqlDB creates a new PostgreSQL database connection
-func NewPsqlDB(uri string, maxConns int, connMaxLifetime time.Duration) (*PsqlDB, error) {
-	pool, err := pgxpool.New(context.Background(), uri)
+// querier runs queries on the pool or in a transaction, Begin of a
+// transaction starts a savepoint
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// NewPsqlDB creates a new PostgreSQL connection pool, non-zero settings
+// override the same parameters of the connection string. Pools of read
+// replicas get the same settings.
+func NewPsqlDB(uri string, pool db.PoolOptions, opts db.PsqlOptions) (*PsqlDB, error) {
+	cfg, err := poolConfig(uri, pool, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaCfgs := make([]*pgxpool.Config, 0, len(opts.ReplicaURIs))
+	for i, replicaURI := range opts.ReplicaURIs {
+		replicaCfg, err := poolConfig(replicaURI, pool, opts)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		replicaCfgs = append(replicaCfgs, replicaCfg)
+	}
+
+	p, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, err
 	}
+	database := &PsqlDB{pool: p, q: p}
+
+	if len(replicaCfgs) == 0 {
+		return database, nil
+	}
+
+	replicas := make([]*pgxpool.Pool, 0, len(replicaCfgs))
+	for _, replicaCfg := range replicaCfgs {
+		r, err := pgxpool.NewWithConfig(context.Background(), replicaCfg)
+		if err != nil {
+			for _, r := range replicas {
+				r.Close()
+			}
+			p.Close()
+			return nil, err
+		}
+		replicas = append(replicas, r)
+	}
+	database.replicas = newReplicaSet(replicas, opts.ReplicaCheckPeriod)
+
+	return database, nil
+}
 
-	pool.Config().MaxConns = int32(maxConns)
-	pool.Config().MaxConnLifetime = connMaxLifetime
+// poolConfig parses the connection string and applies non-zero settings
+func poolConfig(uri string, pool db.PoolOptions, opts db.PsqlOptions) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URI: %w", err)
+	}
+
+	if pool.MaxConns > 0 {
+		cfg.MaxConns = int32(pool.MaxConns)
+	}
+	if opts.MinConns > 0 {
+		cfg.MinConns = int32(opts.MinConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		cfg.MaxConnLifetime = pool.ConnMaxLifetime
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		cfg.MaxConnIdleTime = pool.ConnMaxIdleTime
+	}
+	if opts.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = opts.HealthCheckPeriod
+	}
+	if opts.ConnectTimeout > 0 {
+		cfg.ConnConfig.ConnectTimeout = opts.ConnectTimeout
+	}
+	if opts.ApplicationName != "" {
+		cfg.ConnConfig.RuntimeParams["application_name"] = opts.ApplicationName
+	}
+	if opts.StatementTimeout > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+	if cfg.MinConns > cfg.MaxConns {
+		return nil, fmt.Errorf("minimum number of connections %d exceeds maximum %d", cfg.MinConns, cfg.MaxConns)
+	}
 
-	return &PsqlDB{pool: pool}, nil
+	return cfg, nil
 }
 
 // TestConnection tests the database connection with a timeout
@@ -43,8 +127,11 @@ func (p *PsqlDB) TestConnection(ctx context.Context) error {
 	return p.pool.Ping(ctx)
 }
 
-// Close closes the database connection pool
+// Close closes connection pools of the database and its replicas
 func (p *PsqlDB) Close() error {
+	if p.replicas != nil {
+		p.replicas.close()
+	}
 	if p.pool != nil {
 		p.pool.Close()
 	}
@@ -55,14 +142,16 @@ func (p *PsqlDB) CreateUser(ctx context.Context, username, passwordHash string)
 	const query = `
 		INSERT INTO users (username, password_hash) 
 		VALUES ($1, $2) 
-		RETURNING id, username, password_hash, created_at, updated_at
+		RETURNING id, username, password_hash, is_admin, is_disabled, created_at, updated_at
 	`
 
 	var user iam.User
-	err := p.pool.QueryRow(ctx, query, username, passwordHash).Scan(
+	err := p.q.QueryRow(ctx, query, username, passwordHash).Scan(
 		&user.Id,
 		&user.Username,
 		&user.PasswordHash,
+		&user.IsAdmin,
+		&user.IsDisabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -85,12 +174,16 @@ func (p *PsqlDB) CreateUser(ctx context.Context, username, passwordHash string)
 	return user, nil
 }
 
-// GetUser retrieves user from the database by it's Id or Username
+// GetUser retrieves user from the database by it's Id or Username, at least one of them must be set
 func (p *PsqlDB) GetUser(ctx context.Context, userId, username string) (iam.User, error) {
+	if userId == "" && username == "" {
+		return iam.User{}, db.ErrUserNotFound
+	}
+
 	var sb strings.Builder
 	args := make([]interface{}, 0, 2)
 
-	sb.WriteString(`SELECT id, username, password_hash, created_at, updated_at FROM users `)
+	sb.WriteString(`SELECT id, username, password_hash, is_admin, is_disabled, created_at, updated_at FROM users `)
 
 	sep := " WHERE "
 	if userId != "" {
@@ -108,11 +201,83 @@ func (p *PsqlDB) GetUser(ctx context.Context, userId, username string) (iam.User
 	query := sb.String()
 
 	var user iam.User
-	err := p.pool.QueryRow(ctx, query, args...).Scan(
-		&user.Id, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
+	err := p.read(ctx, func(q querier) error {
+		return q.QueryRow(ctx, query, args...).Scan(
+			&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
+		)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || isInvalidTextRepresentation(err) {
+			return iam.User{}, db.ErrUserNotFound
+		}
+
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// ListUsers retrieves all users ordered by username
+func (p *PsqlDB) ListUsers(ctx context.Context) ([]iam.User, error) {
+	const query = `SELECT id, username, password_hash, is_admin, is_disabled, created_at, updated_at FROM users ORDER BY username`
+
+	var users []iam.User
+	err := p.read(ctx, func(q querier) error {
+		rows, err := q.Query(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		users = []iam.User{}
+		for rows.Next() {
+			var user iam.User
+			if err := rows.Scan(
+				&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
+			); err != nil {
+				return err
+			}
+			users = append(users, user)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// UpdateUser changes fields set in the update and returns the updated user
+func (p *PsqlDB) UpdateUser(ctx context.Context, userId string, update db.UserUpdate) (iam.User, error) {
+	var sb strings.Builder
+	args := make([]interface{}, 0, 4)
+
+	sb.WriteString(`UPDATE users SET updated_at = now()`)
+
+	if update.PasswordHash != nil {
+		args = append(args, *update.PasswordHash)
+		sb.WriteString(fmt.Sprintf(", password_hash = $%d", len(args)))
+	}
+	if update.IsAdmin != nil {
+		args = append(args, *update.IsAdmin)
+		sb.WriteString(fmt.Sprintf(", is_admin = $%d", len(args)))
+	}
+	if update.IsDisabled != nil {
+		args = append(args, *update.IsDisabled)
+		sb.WriteString(fmt.Sprintf(", is_disabled = $%d", len(args)))
+	}
+
+	args = append(args, userId)
+	sb.WriteString(fmt.Sprintf(" WHERE id = $%d RETURNING id, username, password_hash, is_admin, is_disabled, created_at, updated_at", len(args)))
+
+	var user iam.User
+	err := p.q.QueryRow(ctx, sb.String(), args...).Scan(
+		&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) || isInvalidTextRepresentation(err) {
 			return iam.User{}, db.ErrUserNotFound
 		}
 
@@ -126,16 +291,124 @@ func (p *PsqlDB) GetToken(ctx context.Context, tokenId string) (iam.Token, error
 	query := `SELECT id, user_id, is_revoked, issued_at, expires_at, updated_at FROM tokens WHERE id = $1`
 
 	var token iam.Token
-	err := p.pool.QueryRow(ctx, query, tokenId).Scan(
+	err := p.read(ctx, func(q querier) error {
+		return q.QueryRow(ctx, query, tokenId).Scan(
+			&token.Id, &token.UserId, &token.IsRevoked, &token.IssuedAt, &token.ExpiresAt, &token.UpdatedAt,
+		)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || isInvalidTextRepresentation(err) {
+			return iam.Token{}, db.ErrTokenNotFound
+		}
+
+		return iam.Token{}, err
+	}
+
+	return token, err
+}
+
+// CreateToken issues new token for the user valid until expiresAt
+func (p *PsqlDB) CreateToken(ctx context.Context, userId string, expiresAt time.Time) (iam.Token, error) {
+	const query = `
+		INSERT INTO tokens (user_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING id, user_id, is_revoked, issued_at, expires_at, updated_at
+	`
+
+	var token iam.Token
+	err := p.q.QueryRow(ctx, query, userId, expiresAt).Scan(
 		&token.Id, &token.UserId, &token.IsRevoked, &token.IssuedAt, &token.ExpiresAt, &token.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return iam.Token{}, db.ErrTokenNotFound
+			return iam.Token{}, db.ErrUnexpectedEmptyReturn
+		}
+
+		// Handle reference to not existing user
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") { // foreign_key_violation
+			return iam.Token{}, db.ErrUserNotFound
 		}
 
 		return iam.Token{}, err
 	}
 
-	return token, err
+	return token, nil
+}
+
+// ListTokens retrieves tokens of the user ordered by issue time
+func (p *PsqlDB) ListTokens(ctx context.Context, userId string) ([]iam.Token, error) {
+	const query = `
+		SELECT id, user_id, is_revoked, issued_at, expires_at, updated_at FROM tokens
+		WHERE user_id = $1
+		ORDER BY issued_at, id
+	`
+
+	var tokens []iam.Token
+	err := p.read(ctx, func(q querier) error {
+		rows, err := q.Query(ctx, query, userId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		tokens = []iam.Token{}
+		for rows.Next() {
+			var token iam.Token
+			if err := rows.Scan(
+				&token.Id, &token.UserId, &token.IsRevoked, &token.IssuedAt, &token.ExpiresAt, &token.UpdatedAt,
+			); err != nil {
+				return err
+			}
+			tokens = append(tokens, token)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		if isInvalidTextRepresentation(err) {
+			return []iam.Token{}, nil
+		}
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokeToken marks token as revoked
+func (p *PsqlDB) RevokeToken(ctx context.Context, tokenId string) error {
+	const query = `UPDATE tokens SET is_revoked = true, updated_at = now() WHERE id = $1`
+
+	tag, err := p.q.Exec(ctx, query, tokenId)
+	if err != nil {
+		if isInvalidTextRepresentation(err) {
+			return db.ErrTokenNotFound
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return db.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// isInvalidTextRepresentation reports whether err is caused by malformed input,
+// e.g. identifier which is not a valid UUID
+func isInvalidTextRepresentation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "22P02"
+}
+
+// Stats returns current connection pool statistics
+func (p *PsqlDB) Stats() db.PoolStats {
+	stat := p.pool.Stat()
+	return db.PoolStats{
+		MaxConns:     int(stat.MaxConns()),
+		TotalConns:   int(stat.TotalConns()),
+		IdleConns:    int(stat.IdleConns()),
+		InUseConns:   int(stat.AcquiredConns()),
+		WaitCount:    stat.EmptyAcquireCount(),
+		WaitDuration: stat.EmptyAcquireWaitTime(),
+	}
 }
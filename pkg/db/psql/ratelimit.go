@@ -0,0 +1,61 @@
+//go:build psql
+
+package psql
+
+import (
+	"context"
+	"time"
+)
+
+// UpdateRateLimit atomically replaces rate limit state of the key with the value returned by update
+func (p *PsqlDB) UpdateRateLimit(ctx context.Context, key string, update func(tat time.Time) time.Time) error {
+	// Upsert locks the row until commit, so concurrent replicas serialize on the key
+	const selectQuery = `
+		INSERT INTO rate_limits (key, tat) VALUES ($1, 0)
+		ON CONFLICT (key) DO UPDATE SET tat = rate_limits.tat
+		RETURNING tat
+	`
+	const updateQuery = "UPDATE rate_limits SET tat = $2 WHERE key = $1"
+
+	tx, err := p.q.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var tatNs int64
+	if err := tx.QueryRow(ctx, selectQuery, key).Scan(&tatNs); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, updateQuery, key, toUnixNano(update(fromUnixNano(tatNs)))); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteRateLimits removes rate limit states with arrival time before the time
+func (p *PsqlDB) DeleteRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.q.Exec(ctx, "DELETE FROM rate_limits WHERE tat < $1", toUnixNano(before))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// fromUnixNano converts stored nanoseconds to time, zero stays zero time
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// toUnixNano converts time to stored nanoseconds, zero time becomes zero
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
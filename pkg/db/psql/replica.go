@@ -0,0 +1,159 @@
+//go:build psql
+
+package psql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultReplicaCheckPeriod is the interval of replica health checks
+const DefaultReplicaCheckPeriod = 5 * time.Second
+
+// replica is a read replica pool, unhealthy replicas get no reads until
+// the next successful health check
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// replicaSet distributes reads over healthy replicas in round-robin order
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+
+	period time.Duration
+	stop   context.CancelFunc
+	done   chan struct{}
+}
+
+// newReplicaSet starts health checks of the replica pools
+func newReplicaSet(pools []*pgxpool.Pool, period time.Duration) *replicaSet {
+	if period <= 0 {
+		period = DefaultReplicaCheckPeriod
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s := &replicaSet{period: period, stop: stop, done: make(chan struct{})}
+	for _, pool := range pools {
+		r := &replica{pool: pool}
+		r.healthy.Store(true)
+		s.replicas = append(s.replicas, r)
+	}
+
+	go s.run(ctx)
+	return s
+}
+
+// pick returns the next healthy replica, nil if there is none
+func (s *replicaSet) pick() *replica {
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := range n {
+		if r := s.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// run pings every replica each period until the set is closed
+func (s *replicaSet) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range s.replicas {
+				s.check(ctx, r)
+			}
+		}
+	}
+}
+
+// check marks replica healthy if it answers ping within the check period
+func (s *replicaSet) check(ctx context.Context, r *replica) {
+	pingCtx, cancel := context.WithTimeout(ctx, s.period)
+	defer cancel()
+
+	err := r.pool.Ping(pingCtx)
+	if ctx.Err() != nil {
+		// The set is closing, the result says nothing about the replica
+		return
+	}
+	r.healthy.Store(err == nil)
+}
+
+// close stops health checks and closes replica pools
+func (s *replicaSet) close() {
+	s.stop()
+	<-s.done
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
+
+// read runs fn on a healthy replica, the primary serves reads inside
+// transactions, reads of contexts marked by db.WithPrimary and reads no
+// replica can serve. Rows missing on a replica are looked up on the primary
+// as they may be not replicated yet.
+func (p *PsqlDB) read(ctx context.Context, fn func(q querier) error) error {
+	if p.replicas == nil || db.UsePrimary(ctx) {
+		return fn(p.q)
+	}
+
+	r := p.replicas.pick()
+	if r == nil {
+		return fn(p.q)
+	}
+
+	err := fn(r.pool)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return fn(p.q)
+	case isRecoveryConflict(err):
+		return fn(p.q)
+	case isUnavailable(err) && ctx.Err() == nil:
+		r.healthy.Store(false)
+		return fn(p.q)
+	}
+	return err
+}
+
+// isRecoveryConflict reports whether replica canceled query conflicting
+// with replayed changes
+func isRecoveryConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001" // serialization_failure
+}
+
+// isUnavailable reports whether err is caused by a lost or refused
+// connection rather than by the query
+func isUnavailable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// connection_exception class, admin_shutdown, crash_shutdown, cannot_connect_now
+		return pgErr.Code[:2] == "08" || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,233 @@
+//go:build psql
+
+package psql
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// unreachableURI points to a closed port, pools connect lazily, so routing
+// is tested without a server
+const unreachableURI = "postgres://postgres@127.0.0.1:1/tripidium?connect_timeout=1"
+
+// newTestPool creates a pool which connects on the first query
+func newTestPool(t *testing.T, uri string) *pgxpool.Pool {
+	t.Helper()
+
+	pool, err := pgxpool.New(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	return pool
+}
+
+// newTestDB returns database with replicas, health checks run every period
+func newTestDB(t *testing.T, replicas int, period time.Duration) *PsqlDB {
+	t.Helper()
+
+	primary := newTestPool(t, unreachableURI)
+	pools := make([]*pgxpool.Pool, 0, replicas)
+	for range replicas {
+		pools = append(pools, newTestPool(t, unreachableURI))
+	}
+
+	p := &PsqlDB{pool: primary, q: primary, replicas: newReplicaSet(pools, period)}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// served runs read and returns queriers fn was called with
+func served(t *testing.T, p *PsqlDB, ctx context.Context, fn func(q querier) error) ([]querier, error) {
+	t.Helper()
+
+	var calls []querier
+	err := p.read(ctx, func(q querier) error {
+		calls = append(calls, q)
+		return fn(q)
+	})
+	return calls, err
+}
+
+func TestReadRouting(t *testing.T) {
+	ctx := context.Background()
+	p := newTestDB(t, 2, time.Hour)
+	ok := func(querier) error { return nil }
+
+	// Round-robin over replicas
+	counts := map[querier]int{}
+	for range 4 {
+		calls, err := served(t, p, ctx, ok)
+		if err != nil || len(calls) != 1 {
+			t.Fatalf("read = %d calls, %v, want single successful call", len(calls), err)
+		}
+		counts[calls[0]]++
+	}
+	for _, r := range p.replicas.replicas {
+		if counts[r.pool] != 2 {
+			t.Errorf("replica served %d of 4 reads, want 2", counts[r.pool])
+		}
+	}
+
+	// Reads marked by WithPrimary
+	calls, _ := served(t, p, db.WithPrimary(ctx), ok)
+	if len(calls) != 1 || calls[0] != p.q {
+		t.Errorf("read with WithPrimary is not served by the primary")
+	}
+
+	// Unhealthy replicas are skipped
+	p.replicas.replicas[0].healthy.Store(false)
+	for range 2 {
+		calls, _ = served(t, p, ctx, ok)
+		if len(calls) != 1 || calls[0] != p.replicas.replicas[1].pool {
+			t.Errorf("read is not served by the only healthy replica")
+		}
+	}
+
+	// The primary serves reads if no replica is healthy
+	p.replicas.replicas[1].healthy.Store(false)
+	calls, _ = served(t, p, ctx, ok)
+	if len(calls) != 1 || calls[0] != p.q {
+		t.Errorf("read without healthy replicas is not served by the primary")
+	}
+
+	// Transactions have no replicas
+	tx := &PsqlDB{pool: p.pool, q: p.q}
+	calls, _ = served(t, tx, ctx, ok)
+	if len(calls) != 1 || calls[0] != p.q {
+		t.Errorf("read in transaction is not served by the primary")
+	}
+}
+
+func TestReadFallback(t *testing.T) {
+	errQuery := &pgconn.PgError{Code: "42P01"} // undefined_table
+
+	tests := []struct {
+		name        string
+		replicaErr  error
+		canceled    bool
+		wantPrimary bool
+		wantHealthy bool
+		wantErr     error
+	}{
+		{name: "not replicated row", replicaErr: pgx.ErrNoRows, wantPrimary: true, wantHealthy: true},
+		{name: "recovery conflict", replicaErr: &pgconn.PgError{Code: "40001"}, wantPrimary: true, wantHealthy: true},
+		{name: "connection failure", replicaErr: &pgconn.PgError{Code: "08006"}, wantPrimary: true, wantHealthy: false},
+		{name: "shutdown", replicaErr: &pgconn.PgError{Code: "57P01"}, wantPrimary: true, wantHealthy: false},
+		{name: "canceled read", replicaErr: &pgconn.PgError{Code: "08006"}, canceled: true, wantHealthy: true, wantErr: &pgconn.PgError{Code: "08006"}},
+		{name: "query error", replicaErr: errQuery, wantHealthy: true, wantErr: errQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestDB(t, 1, time.Hour)
+			r := p.replicas.replicas[0]
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+
+			calls, err := served(t, p, ctx, func(q querier) error {
+				if q == r.pool {
+					return tt.replicaErr
+				}
+				return nil
+			})
+
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Errorf("read err = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("read err = %v, want nil", err)
+			}
+
+			gotPrimary := len(calls) == 2 && calls[1] == p.q
+			if len(calls) == 0 || calls[0] != r.pool || gotPrimary != tt.wantPrimary {
+				t.Errorf("read served by %d queriers, primary fallback = %v, want %v", len(calls), gotPrimary, tt.wantPrimary)
+			}
+			if healthy := r.healthy.Load(); healthy != tt.wantHealthy {
+				t.Errorf("replica healthy = %v, want %v", healthy, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestReadEjectsUnreachableReplica(t *testing.T) {
+	p := newTestDB(t, 1, time.Hour)
+	r := p.replicas.replicas[0]
+
+	var replicaErr error
+	calls, err := served(t, p, context.Background(), func(q querier) error {
+		if q != r.pool {
+			return nil
+		}
+		replicaErr = q.QueryRow(context.Background(), "SELECT 1").Scan(new(int))
+		return replicaErr
+	})
+	if err != nil {
+		t.Fatalf("read err = %v, want nil after fallback to the primary", err)
+	}
+	if !isUnavailable(replicaErr) {
+		t.Errorf("isUnavailable(%v) = false, want true", replicaErr)
+	}
+	if len(calls) != 2 || calls[1] != p.q {
+		t.Errorf("read is not repeated on the primary")
+	}
+	if r.healthy.Load() {
+		t.Errorf("unreachable replica is not ejected")
+	}
+}
+
+func TestReplicaHealthCheck(t *testing.T) {
+	p := newTestDB(t, 1, 50*time.Millisecond)
+	r := p.replicas.replicas[0]
+
+	waitHealthy(t, r, false)
+
+	uri := os.Getenv("TRIPIDIUM_TEST_PSQL_URI")
+	if uri == "" {
+		t.Skip("TRIPIDIUM_TEST_PSQL_URI is not set, readmission is not checked")
+	}
+
+	// An ejected replica gets reads again after a successful check
+	reachable := newTestPool(t, uri)
+	set := newReplicaSet([]*pgxpool.Pool{reachable}, 50*time.Millisecond)
+	defer set.close()
+	set.replicas[0].healthy.Store(false)
+
+	waitHealthy(t, set.replicas[0], true)
+}
+
+// waitHealthy waits for health checks to set the replica state
+func waitHealthy(t *testing.T, r *replica, healthy bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.healthy.Load() != healthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("replica healthy = %v after health checks, want %v", !healthy, healthy)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	if isUnavailable(errors.New("boom")) {
+		t.Errorf("isUnavailable of plain error = true, want false")
+	}
+	if isUnavailable(&pgconn.PgError{Code: "23505"}) {
+		t.Errorf("isUnavailable of unique violation = true, want false")
+	}
+}
@@ -0,0 +1,43 @@
+//go:build psql
+
+package psql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// isoLevels maps isolation levels to PostgreSQL ones, default is read committed
+var isoLevels = map[db.IsolationLevel]pgx.TxIsoLevel{
+	db.IsolationReadCommitted:  pgx.ReadCommitted,
+	db.IsolationRepeatableRead: pgx.RepeatableRead,
+	db.IsolationSerializable:   pgx.Serializable,
+}
+
+// WithTx runs fn in a transaction retrying attempts failed by a
+// serialization conflict or a deadlock
+func (p *PsqlDB) WithTx(ctx context.Context, fn func(tx db.Tx) error, opts ...db.TxOption) error {
+	o := db.NewTxOptions(opts...)
+
+	txOptions := pgx.TxOptions{IsoLevel: isoLevels[o.Isolation]}
+	if o.ReadOnly {
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+
+	return db.RetryTx(ctx, o, isSerializationFailure, func() error {
+		return pgx.BeginTxFunc(ctx, p.pool, txOptions, func(tx pgx.Tx) error {
+			return fn(&PsqlDB{pool: p.pool, q: tx})
+		})
+	})
+}
+
+// isSerializationFailure reports whether transaction may succeed on retry
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01") // serialization_failure, deadlock_detected
+}
@@ -2,41 +2,60 @@ package db
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 )
 
 // DatabaseFactory handles database initialization
 type DatabaseFactory interface {
-	Create(uri string, maxConns int, connMaxLifetime int64) (Database, error)
+	Create(opts Options) (Database, error)
 	GetType() string
 }
 
-var databaseFactories = make(map[string]DatabaseFactory)
+var (
+	factoriesMu       sync.RWMutex
+	databaseFactories = make(map[string]DatabaseFactory)
+)
 
-// RegisterDatabase adds a database factory to the registry
+// RegisterDatabase adds a database factory to the registry, it panics if
+// factory is nil or its type is already registered
 func RegisterDatabase(factory DatabaseFactory) {
-	databaseFactories[factory.GetType()] = factory
+	if factory == nil {
+		panic("db: RegisterDatabase factory is nil")
+	}
+
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	dbType := factory.GetType()
+	if _, exists := databaseFactories[dbType]; exists {
+		panic("db: RegisterDatabase called twice for type " + dbType)
+	}
+	databaseFactories[dbType] = factory
 }
 
 // CreateDatabase creates a database connection using the appropriate factory
-func CreateDatabase(dbType, uri string, maxConns int, connMaxLifetime int64) (Database, error) {
+func CreateDatabase(dbType string, opts Options) (Database, error) {
+	factoriesMu.RLock()
 	factory, exists := databaseFactories[dbType]
+	factoriesMu.RUnlock()
+
 	if !exists {
-		// Collect list of available types for error
-		available := make([]string, 0, len(databaseFactories))
-		for dbType := range databaseFactories {
-			available = append(available, dbType)
-		}
-		return nil, fmt.Errorf("unsupported database type: %s. Available types: %v", dbType, available)
+		return nil, fmt.Errorf("unsupported database type: %s. Available types: %v", dbType, GetAvailableDatabaseTypes())
 	}
 
-	return factory.Create(uri, maxConns, connMaxLifetime)
+	return factory.Create(opts)
 }
 
-// GetAvailableDatabaseTypes returns a list of available database types
+// GetAvailableDatabaseTypes returns a sorted list of available database types
 func GetAvailableDatabaseTypes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
 	types := make([]string, 0, len(databaseFactories))
 	for dbType := range databaseFactories {
 		types = append(types, dbType)
 	}
+	sort.Strings(types)
 	return types
 }
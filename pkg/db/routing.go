@@ -0,0 +1,17 @@
+package db
+
+import "context"
+
+type primaryKey struct{}
+
+// WithPrimary returns context making reads of backends with read replicas
+// run on the primary, e.g. to read own writes without replication lag
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsePrimary reports whether reads in the context must run on the primary
+func UsePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
@@ -0,0 +1,8 @@
+package db
+
+// Snapshotter is an optional interface of Database implementations keeping
+// data in memory and able to persist it
+type Snapshotter interface {
+	// Snapshot writes data changed since the last snapshot to durable storage
+	Snapshot() error
+}
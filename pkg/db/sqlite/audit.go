@@ -0,0 +1,120 @@
+//go:build sqlite || sqlite_purego
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+	"github.com/kompotkot/tripidium/pkg/iam"
+)
+
+// CreateAuditEvent appends event to the audit log chaining it to the last stored event
+func (s *SqliteDB) CreateAuditEvent(ctx context.Context, event iam.AuditEvent) (iam.AuditEvent, error) {
+	const query = `
+		INSERT INTO audit_events (actor, action, target, ip, user_agent, request_id, result, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	// Connection pool holds a single connection, so transactions are serialized
+	err := s.inTx(ctx, func(q querier) error {
+		var prevHash string
+		err := q.QueryRowContext(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		event.PrevHash = prevHash
+		event.Hash = event.ComputeHash()
+
+		res, err := q.ExecContext(ctx, query,
+			event.Actor, event.Action, event.Target, event.IP, event.UserAgent, event.RequestId,
+			event.Result, event.CreatedAt, event.PrevHash, event.Hash,
+		)
+		if err != nil {
+			return err
+		}
+
+		event.Id, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return iam.AuditEvent{}, err
+	}
+
+	return event, nil
+}
+
+// ListAuditEvents retrieves audit events matching the filter ordered by Id
+func (s *SqliteDB) ListAuditEvents(ctx context.Context, filter db.AuditEventFilter) ([]iam.AuditEvent, error) {
+	var sb strings.Builder
+	args := make([]interface{}, 0, 8)
+
+	sb.WriteString(`SELECT id, actor, action, target, ip, user_agent, request_id, result, created_at, prev_hash, hash FROM audit_events `)
+
+	sep := " WHERE "
+	addCondition := func(cond string, arg interface{}) {
+		sb.WriteString(sep)
+		sb.WriteString(cond)
+		args = append(args, arg)
+		sep = " AND "
+	}
+
+	if filter.Actor != "" {
+		addCondition("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		addCondition("action = ?", filter.Action)
+	}
+	if filter.Target != "" {
+		addCondition("target = ?", filter.Target)
+	}
+	if filter.Result != "" {
+		addCondition("result = ?", filter.Result)
+	}
+	if !filter.Since.IsZero() {
+		addCondition("created_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		addCondition("created_at < ?", filter.Until.UTC())
+	}
+	if filter.AfterId > 0 {
+		addCondition("id > ?", filter.AfterId)
+	}
+
+	sb.WriteString(" ORDER BY id")
+
+	if filter.Limit > 0 {
+		sb.WriteString(" LIMIT ?")
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.q.QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []iam.AuditEvent{}
+	for rows.Next() {
+		var e iam.AuditEvent
+		if err := rows.Scan(
+			&e.Id, &e.Actor, &e.Action, &e.Target, &e.IP, &e.UserAgent, &e.RequestId,
+			&e.Result, &e.CreatedAt, &e.PrevHash, &e.Hash,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,44 @@
+//go:build sqlite && !sqlite_purego
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// newConnector returns connector of mattn/go-sqlite3 driver applying pragmas
+// to every new connection
+func newConnector(dsn string, pragmas []string) connector {
+	driver := &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, pragma := range pragmas {
+				if _, err := conn.Exec("PRAGMA "+pragma, nil); err != nil {
+					return fmt.Errorf("failed to set pragma %s: %w", pragma, err)
+				}
+			}
+			return nil
+		},
+	}
+	return connector{driver: driver, dsn: dsn}
+}
+
+// isBusy reports whether err is caused by a database locked by another connection
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// isUniqueViolation reports whether err is caused by a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// isForeignKeyViolation reports whether err is caused by a FOREIGN KEY constraint
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
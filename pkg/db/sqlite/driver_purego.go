@@ -0,0 +1,61 @@
+//go:build sqlite_purego
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// newConnector returns connector of modernc.org/sqlite driver applying
+// pragmas to every new connection. Times are written in the format of
+// mattn/go-sqlite3, so database files are shared by cgo and pure-Go builds.
+func newConnector(dsn string, pragmas []string) connector {
+	driver := &sqlite.Driver{}
+	driver.RegisterConnectionHook(func(conn sqlite.ExecQuerierContext, _ string) error {
+		for _, pragma := range pragmas {
+			if _, err := conn.ExecContext(context.Background(), "PRAGMA "+pragma, nil); err != nil {
+				return fmt.Errorf("failed to set pragma %s: %w", pragma, err)
+			}
+		}
+		return nil
+	})
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return connector{driver: driver, dsn: dsn + sep + "_time_format=sqlite"}
+}
+
+// isBusy reports whether err is caused by a database locked by another connection
+func isBusy(err error) bool {
+	code, ok := errorCode(err)
+	return ok && (code&0xff == sqlite3.SQLITE_BUSY || code&0xff == sqlite3.SQLITE_LOCKED)
+}
+
+// isUniqueViolation reports whether err is caused by a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	code, ok := errorCode(err)
+	return ok && code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// isForeignKeyViolation reports whether err is caused by a FOREIGN KEY constraint
+func isForeignKeyViolation(err error) bool {
+	code, ok := errorCode(err)
+	return ok && code == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// errorCode returns extended result code of the SQLite error wrapped by err
+func errorCode(err error) (int, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, false
+	}
+	return sqliteErr.Code(), true
+}
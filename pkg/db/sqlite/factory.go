@@ -1,4 +1,4 @@
-//go:build sqlite
+//go:build sqlite || sqlite_purego
 
 package sqlite
 
@@ -15,8 +15,8 @@ func NewFactory() db.DatabaseFactory {
 }
 
 // Create creates a new SQLite database connection
-func (f *Factory) Create(uri string, maxConns int, connMaxLifetime int64) (db.Database, error) {
-	return NewSqliteDB(uri, true, "NORMAL")
+func (f *Factory) Create(opts db.Options) (db.Database, error) {
+	return NewSqliteDB(opts.URI, opts.Pool, opts.Sqlite)
 }
 
 // GetType returns the database type
@@ -0,0 +1,227 @@
+//go:build sqlite || sqlite_purego
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// migrations lists SQLite schema changes in order of application
+var migrations = []db.Migration{
+	{
+		Version: 1,
+		Name:    "users_tokens",
+		Up: `
+			CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+				username TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS tokens (
+				id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				is_revoked BOOLEAN NOT NULL DEFAULT false,
+				issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				expires_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS tokens;
+			DROP TABLE IF EXISTS users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "users_is_admin",
+		Up:      `ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;`,
+		Down:    `ALTER TABLE users DROP COLUMN is_admin;`,
+	},
+	{
+		Version: 3,
+		Name:    "audit_events",
+		Up: `
+			CREATE TABLE audit_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				actor TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target TEXT NOT NULL DEFAULT '',
+				ip TEXT NOT NULL DEFAULT '',
+				user_agent TEXT NOT NULL DEFAULT '',
+				request_id TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				prev_hash TEXT NOT NULL DEFAULT '',
+				hash TEXT NOT NULL UNIQUE
+			);
+
+			CREATE INDEX audit_events_actor_idx ON audit_events (actor);
+			CREATE INDEX audit_events_action_idx ON audit_events (action);
+			CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+			CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+			BEGIN
+				SELECT RAISE(ABORT, 'audit_events is append-only');
+			END;
+
+			CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+			BEGIN
+				SELECT RAISE(ABORT, 'audit_events is append-only');
+			END;
+		`,
+		Down: `DROP TABLE IF EXISTS audit_events;`,
+	},
+	{
+		Version: 4,
+		Name:    "rate_limits",
+		Up: `
+			CREATE TABLE rate_limits (
+				key TEXT PRIMARY KEY,
+				tat INTEGER NOT NULL
+			);
+
+			CREATE INDEX rate_limits_tat_idx ON rate_limits (tat);
+		`,
+		Down: `DROP TABLE IF EXISTS rate_limits;`,
+	},
+	{
+		Version: 5,
+		Name:    "users_is_disabled",
+		Up:      `ALTER TABLE users ADD COLUMN is_disabled BOOLEAN NOT NULL DEFAULT false;`,
+		Down:    `ALTER TABLE users DROP COLUMN is_disabled;`,
+	},
+}
+
+// Migrate applies pending schema migrations, an up-to-date schema is not
+// written to, so read-only databases pass
+func (s *SqliteDB) Migrate(ctx context.Context) error {
+	current, latest, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if current >= latest {
+		return nil
+	}
+
+	const query = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+
+	if _, err := s.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// SchemaVersion returns applied schema version and the latest version known
+// to the implementation, version is 0 before the first migration
+func (s *SqliteDB) SchemaVersion(ctx context.Context) (int, int, error) {
+	latest := migrations[len(migrations)-1].Version
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')").Scan(&exists); err != nil {
+		return 0, latest, err
+	}
+	if !exists {
+		return 0, latest, nil
+	}
+
+	var current int
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return 0, latest, err
+	}
+
+	return current, latest, nil
+}
+
+// applyMigration runs migration in a transaction if it was not applied yet
+func (s *SqliteDB) applyMigration(ctx context.Context, m db.Migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = ?)", m.Version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Rollback reverts applied migrations newer than version in reverse order
+func (s *SqliteDB) Rollback(ctx context.Context, version int) error {
+	for i := len(migrations) - 1; i >= 0 && migrations[i].Version > version; i-- {
+		m := migrations[i]
+		if err := s.revertMigration(ctx, m); err != nil {
+			return fmt.Errorf("failed to revert migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Migrations returns schema migrations known to the implementation in order of application
+func (s *SqliteDB) Migrations() []db.Migration {
+	return migrations
+}
+
+// revertMigration runs down migration in a transaction if it was applied
+func (s *SqliteDB) revertMigration(ctx context.Context, m db.Migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
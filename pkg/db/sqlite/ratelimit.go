@@ -0,0 +1,54 @@
+//go:build sqlite || sqlite_purego
+
+package sqlite
+
+import (
+	"context"
+	"time"
+)
+
+// UpdateRateLimit atomically replaces rate limit state of the key with the value returned by update
+func (s *SqliteDB) UpdateRateLimit(ctx context.Context, key string, update func(tat time.Time) time.Time) error {
+	// Upsert takes the write lock at the start of the transaction
+	const selectQuery = `
+		INSERT INTO rate_limits (key, tat) VALUES (?, 0)
+		ON CONFLICT (key) DO UPDATE SET tat = rate_limits.tat
+		RETURNING tat
+	`
+	const updateQuery = "UPDATE rate_limits SET tat = ? WHERE key = ?"
+
+	return s.inTx(ctx, func(q querier) error {
+		var tatNs int64
+		if err := q.QueryRowContext(ctx, selectQuery, key).Scan(&tatNs); err != nil {
+			return err
+		}
+
+		_, err := q.ExecContext(ctx, updateQuery, toUnixNano(update(fromUnixNano(tatNs))), key)
+		return err
+	})
+}
+
+// DeleteRateLimits removes rate limit states with arrival time before the time
+func (s *SqliteDB) DeleteRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.q.ExecContext(ctx, "DELETE FROM rate_limits WHERE tat < ?", toUnixNano(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// fromUnixNano converts stored nanoseconds to time, zero stays zero time
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// toUnixNano converts time to stored nanoseconds, zero time becomes zero
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
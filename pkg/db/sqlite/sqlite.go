@@ -1,18 +1,19 @@
-//go:build sqlite
+//go:build sqlite || sqlite_purego
 
 package sqlite
 
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/kompotkot/tripidium/pkg/db"
 	"github.com/kompotkot/tripidium/pkg/iam"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // validSyncModes lists the allowed values for the synchronous pragma
@@ -26,52 +27,93 @@ var validSyncModes = map[string]bool{
 // SqliteDB represents a SQLite database connection
 type SqliteDB struct {
 	db *sql.DB
+	// q runs data queries, it is the transaction inside WithTx
+	q querier
+	// tx is set for the value passed to WithTx callback
+	tx *sql.Tx
 }
 
-// NewSqliteDB creates a new SQLite database connection with specified options
-func NewSqliteDB(uri string, enableWal bool, syncPragma string) (*SqliteDB, error) {
-	params := url.Values{}
+// querier runs queries on the database or in a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
-	if enableWal {
-		params.Add("_journal_mode", "WAL")
+// NewSqliteDB creates a new SQLite database connection, pragmas of options
+// are applied to every new connection of the pool
+func NewSqliteDB(uri string, pool db.PoolOptions, opts db.SqliteOptions) (*SqliteDB, error) {
+	pragmas, err := sqlitePragmas(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	if syncPragma != "" {
-		ucSyncPragma := strings.ToUpper(syncPragma)
-		if !validSyncModes[ucSyncPragma] {
-			return nil, fmt.Errorf("invalid sync pragma value: %s. Must be one of OFF, NORMAL, FULL, EXTRA", syncPragma)
-		}
-		params.Add("_synchronous", ucSyncPragma)
+	sqlDB := sql.OpenDB(newConnector(uri, pragmas))
+
+	// Configure connection pool settings
+	sqlDB.SetMaxOpenConns(1) // SQLite only supports one writer at a time
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	// Open the first connection to report invalid file or pragmas early
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to open database %s: %w", uri, err)
 	}
 
-	constructedUri := uri
-	if len(params) > 0 {
-		if strings.Contains(uri, "?") {
-			constructedUri += "&" + params.Encode()
-		} else {
-			constructedUri += "?" + params.Encode()
+	return &SqliteDB{db: sqlDB, q: sqlDB}, nil
+}
+
+// sqlitePragmas converts options to pragma assignments
+func sqlitePragmas(opts db.SqliteOptions) ([]string, error) {
+	var pragmas []string
+
+	// Set first, so the following pragmas wait for locks too
+	if opts.BusyTimeout > 0 {
+		pragmas = append(pragmas, "busy_timeout = "+strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10))
+	}
+	if opts.WAL {
+		pragmas = append(pragmas, "journal_mode = WAL")
+	}
+	if opts.Synchronous != "" {
+		ucSyncPragma := strings.ToUpper(opts.Synchronous)
+		if !validSyncModes[ucSyncPragma] {
+			return nil, fmt.Errorf("invalid sync pragma value: %s. Must be one of OFF, NORMAL, FULL, EXTRA", opts.Synchronous)
 		}
+		pragmas = append(pragmas, "synchronous = "+ucSyncPragma)
 	}
-
-	db, err := sql.Open("sqlite3", constructedUri)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database with DSN '%s': %w", constructedUri, err)
+	if opts.CacheSize != 0 {
+		pragmas = append(pragmas, "cache_size = "+strconv.Itoa(opts.CacheSize))
+	}
+	if opts.MmapSize > 0 {
+		pragmas = append(pragmas, "mmap_size = "+strconv.FormatInt(opts.MmapSize, 10))
 	}
 
-	// Configure connection pool settings
-	db.SetMaxOpenConns(1) // SQLite only supports one writer at a time
-	db.SetMaxIdleConns(1)
-	db.SetConnMaxLifetime(time.Hour)
+	// Foreign keys are required for ON DELETE CASCADE and other FK actions to work
+	pragmas = append(pragmas, "foreign_keys = ON")
 
-	// Enable foreign key support for this connection.
-	// This is crucial for ON DELETE CASCADE and other FK actions to work.
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
-	if err != nil {
-		db.Close() // Close DB if we can't set the pragma
-		return nil, fmt.Errorf("failed to enable foreign key support for DSN '%s': %w", constructedUri, err)
+	if opts.ReadOnly {
+		pragmas = append(pragmas, "query_only = ON")
 	}
 
-	return &SqliteDB{db: db}, nil
+	return pragmas, nil
+}
+
+// connector opens connections of the driver, it lets every database apply
+// its own pragmas without registering a named driver. Driver files of the
+// cgo and pure-Go builds create it with newConnector.
+type connector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
 }
 
 // TestConnection tests the database connection with a timeout
@@ -90,14 +132,244 @@ func (s *SqliteDB) Close() error {
 	return nil
 }
 
-func (p *SqliteDB) CreateUser(ctx context.Context, username, passwordHash string) (iam.User, error) {
-	return iam.User{}, nil
+// Stats returns current connection pool statistics
+func (s *SqliteDB) Stats() db.PoolStats {
+	stat := s.db.Stats()
+	return db.PoolStats{
+		MaxConns:     stat.MaxOpenConnections,
+		TotalConns:   stat.OpenConnections,
+		IdleConns:    stat.Idle,
+		InUseConns:   stat.InUse,
+		WaitCount:    stat.WaitCount,
+		WaitDuration: stat.WaitDuration,
+	}
 }
 
-func (p *SqliteDB) GetUser(ctx context.Context, userId, username string) (iam.User, error) {
-	return iam.User{}, nil
+// CreateUser creates new user in database
+func (s *SqliteDB) CreateUser(ctx context.Context, username, passwordHash string) (iam.User, error) {
+	const query = `
+		INSERT INTO users (username, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id, username, password_hash, is_admin, is_disabled, created_at, updated_at
+	`
+
+	now := time.Now().UTC()
+
+	var user iam.User
+	err := s.q.QueryRowContext(ctx, query, username, passwordHash, now, now).Scan(
+		&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return iam.User{}, db.ErrUnexpectedEmptyReturn
+		}
+
+		// Handle the username uniqueness error
+		if isUniqueViolation(err) {
+			return iam.User{}, db.ErrUserAlreadyExists
+		}
+
+		return iam.User{}, err
+	}
+
+	return user, nil
 }
 
-func (p *SqliteDB) GetToken(ctx context.Context, tokenId string) (iam.Token, error) {
-	return iam.Token{}, nil
+// GetUser retrieves user from the database by it's Id or Username, at least one of them must be set
+func (s *SqliteDB) GetUser(ctx context.Context, userId, username string) (iam.User, error) {
+	if userId == "" && username == "" {
+		return iam.User{}, db.ErrUserNotFound
+	}
+
+	var sb strings.Builder
+	args := make([]interface{}, 0, 2)
+
+	sb.WriteString(`SELECT id, username, password_hash, is_admin, is_disabled, created_at, updated_at FROM users `)
+
+	sep := " WHERE "
+	if userId != "" {
+		sb.WriteString(sep)
+		sb.WriteString("id = ?")
+		args = append(args, userId)
+		sep = " AND "
+	}
+	if username != "" {
+		sb.WriteString(sep)
+		sb.WriteString("username = ?")
+		args = append(args, username)
+	}
+
+	var user iam.User
+	err := s.q.QueryRowContext(ctx, sb.String(), args...).Scan(
+		&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return iam.User{}, db.ErrUserNotFound
+		}
+
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// ListUsers retrieves all users ordered by username
+func (s *SqliteDB) ListUsers(ctx context.Context) ([]iam.User, error) {
+	const query = `SELECT id, username, password_hash, is_admin, is_disabled, created_at, updated_at FROM users ORDER BY username`
+
+	rows, err := s.q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []iam.User{}
+	for rows.Next() {
+		var user iam.User
+		if err := rows.Scan(
+			&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUser changes fields set in the update and returns the updated user
+func (s *SqliteDB) UpdateUser(ctx context.Context, userId string, update db.UserUpdate) (iam.User, error) {
+	var sb strings.Builder
+	args := make([]interface{}, 0, 5)
+
+	sb.WriteString(`UPDATE users SET updated_at = ?`)
+	args = append(args, time.Now().UTC())
+
+	if update.PasswordHash != nil {
+		sb.WriteString(", password_hash = ?")
+		args = append(args, *update.PasswordHash)
+	}
+	if update.IsAdmin != nil {
+		sb.WriteString(", is_admin = ?")
+		args = append(args, *update.IsAdmin)
+	}
+	if update.IsDisabled != nil {
+		sb.WriteString(", is_disabled = ?")
+		args = append(args, *update.IsDisabled)
+	}
+
+	sb.WriteString(` WHERE id = ? RETURNING id, username, password_hash, is_admin, is_disabled, created_at, updated_at`)
+	args = append(args, userId)
+
+	var user iam.User
+	err := s.q.QueryRowContext(ctx, sb.String(), args...).Scan(
+		&user.Id, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.IsDisabled, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return iam.User{}, db.ErrUserNotFound
+		}
+
+		return iam.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetToken retrieves a token from the database
+func (s *SqliteDB) GetToken(ctx context.Context, tokenId string) (iam.Token, error) {
+	const query = `SELECT id, user_id, is_revoked, issued_at, expires_at, updated_at FROM tokens WHERE id = ?`
+
+	var token iam.Token
+	err := s.q.QueryRowContext(ctx, query, tokenId).Scan(
+		&token.Id, &token.UserId, &token.IsRevoked, &token.IssuedAt, &token.ExpiresAt, &token.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return iam.Token{}, db.ErrTokenNotFound
+		}
+
+		return iam.Token{}, err
+	}
+
+	return token, nil
+}
+
+// CreateToken issues new token for the user valid until expiresAt
+func (s *SqliteDB) CreateToken(ctx context.Context, userId string, expiresAt time.Time) (iam.Token, error) {
+	const query = `
+		INSERT INTO tokens (user_id, issued_at, expires_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id, user_id, is_revoked, issued_at, expires_at, updated_at
+	`
+
+	now := time.Now().UTC()
+
+	var token iam.Token
+	err := s.q.QueryRowContext(ctx, query, userId, now, expiresAt.UTC(), now).Scan(
+		&token.Id, &token.UserId, &token.IsRevoked, &token.IssuedAt, &token.ExpiresAt, &token.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return iam.Token{}, db.ErrUnexpectedEmptyReturn
+		}
+
+		// Handle reference to not existing user
+		if isForeignKeyViolation(err) {
+			return iam.Token{}, db.ErrUserNotFound
+		}
+
+		return iam.Token{}, err
+	}
+
+	return token, nil
+}
+
+// ListTokens retrieves tokens of the user ordered by issue time
+func (s *SqliteDB) ListTokens(ctx context.Context, userId string) ([]iam.Token, error) {
+	const query = `
+		SELECT id, user_id, is_revoked, issued_at, expires_at, updated_at FROM tokens
+		WHERE user_id = ?
+		ORDER BY issued_at, id
+	`
+
+	rows, err := s.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []iam.Token{}
+	for rows.Next() {
+		var token iam.Token
+		if err := rows.Scan(
+			&token.Id, &token.UserId, &token.IsRevoked, &token.IssuedAt, &token.ExpiresAt, &token.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeToken marks token as revoked
+func (s *SqliteDB) RevokeToken(ctx context.Context, tokenId string) error {
+	const query = `UPDATE tokens SET is_revoked = true, updated_at = ? WHERE id = ?`
+
+	res, err := s.q.ExecContext(ctx, query, time.Now().UTC(), tokenId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return db.ErrTokenNotFound
+	}
+
+	return nil
 }
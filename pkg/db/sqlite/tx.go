@@ -0,0 +1,47 @@
+//go:build sqlite || sqlite_purego
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kompotkot/tripidium/pkg/db"
+)
+
+// WithTx runs fn in a transaction retrying attempts failed by a locked
+// database. SQLite transactions are serializable, isolation level is ignored.
+// The pool holds a single connection, so fn must not use the database itself.
+func (s *SqliteDB) WithTx(ctx context.Context, fn func(tx db.Tx) error, opts ...db.TxOption) error {
+	o := db.NewTxOptions(opts...)
+	return db.RetryTx(ctx, o, isBusy, func() error {
+		tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: o.ReadOnly})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(&SqliteDB{db: s.db, q: tx, tx: tx}); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// inTx runs fn in the transaction of WithTx or in a new one
+func (s *SqliteDB) inTx(ctx context.Context, fn func(q querier) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,20 @@
+package db
+
+import "time"
+
+// PoolStats represents a snapshot of database connection pool state
+type PoolStats struct {
+	MaxConns     int
+	TotalConns   int
+	IdleConns    int
+	InUseConns   int
+	WaitCount    int64
+	WaitDuration time.Duration
+}
+
+// StatsProvider is an optional interface of Database implementations
+// able to report connection pool statistics
+type StatsProvider interface {
+	// Stats returns current connection pool statistics
+	Stats() PoolStats
+}
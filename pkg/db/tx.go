@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// IsolationLevel of a transaction
+type IsolationLevel int
+
+const (
+	// IsolationDefault keeps default level of the backend
+	IsolationDefault IsolationLevel = iota
+	IsolationReadCommitted
+	IsolationRepeatableRead
+	IsolationSerializable
+)
+
+// DefaultTxMaxRetries is a number of retries of a transaction failed by a
+// serialization conflict or a locked database
+const DefaultTxMaxRetries = 3
+
+// txRetryBackoff is the delay before the first retry, it doubles every attempt
+const txRetryBackoff = 10 * time.Millisecond
+
+// TxOptions configure transaction started by WithTx
+type TxOptions struct {
+	Isolation IsolationLevel
+	ReadOnly  bool
+	// MaxRetries limits retries of transient failures, 0 disables them
+	MaxRetries int
+}
+
+// TxOption changes TxOptions
+type TxOption func(*TxOptions)
+
+// WithIsolation sets isolation level of the transaction
+func WithIsolation(level IsolationLevel) TxOption {
+	return func(o *TxOptions) {
+		o.Isolation = level
+	}
+}
+
+// WithReadOnly starts read-only transaction
+func WithReadOnly() TxOption {
+	return func(o *TxOptions) {
+		o.ReadOnly = true
+	}
+}
+
+// WithMaxRetries sets number of retries of transient failures
+func WithMaxRetries(n int) TxOption {
+	return func(o *TxOptions) {
+		o.MaxRetries = n
+	}
+}
+
+// NewTxOptions applies options over defaults
+func NewTxOptions(opts ...TxOption) TxOptions {
+	o := TxOptions{MaxRetries: DefaultTxMaxRetries}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// RetryTx calls attempt until it succeeds, fails with an error not accepted
+// by retryable or retries are exhausted. Delay between attempts grows
+// exponentially with jitter. Backends use it to implement WithTx.
+func RetryTx(ctx context.Context, opts TxOptions, retryable func(error) bool, attempt func() error) error {
+	backoff := txRetryBackoff
+	for retry := 0; ; retry++ {
+		err := attempt()
+		if err == nil || retry >= opts.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff/2 + rand.N(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
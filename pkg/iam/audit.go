@@ -0,0 +1,71 @@
+package iam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit event actions
+const (
+	AuditActionSignUp         = "user.signup"
+	AuditActionUserCreate     = "user.create"
+	AuditActionUserDisable    = "user.disable"
+	AuditActionUserEnable     = "user.enable"
+	AuditActionLogin          = "user.login"
+	AuditActionLoginFailed    = "user.login_failed"
+	AuditActionPasswordChange = "user.password_change"
+	AuditActionTokenRefresh   = "token.refresh"
+	AuditActionTokenRevoke    = "token.revoke"
+	AuditActionConfigReload   = "config.reload"
+)
+
+// Audit event results
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditEvent represents a security-relevant event, each event is chained
+// to the previous one by its hash
+type AuditEvent struct {
+	Id        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestId string    `json:"request_id"`
+	Result    string    `json:"result"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// ComputeHash returns hex encoded SHA-256 of the event content and previous event hash
+func (e AuditEvent) ComputeHash() string {
+	fields := []string{
+		e.PrevHash,
+		e.Actor,
+		e.Action,
+		e.Target,
+		e.IP,
+		e.UserAgent,
+		e.RequestId,
+		e.Result,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	// Prefix each field with its length to keep the encoding unambiguous
+	var sb strings.Builder
+	for _, f := range fields {
+		sb.WriteString(strconv.Itoa(len(f)))
+		sb.WriteString(":")
+		sb.WriteString(f)
+	}
+
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
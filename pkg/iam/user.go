@@ -8,6 +8,8 @@ type User struct {
 	Username     string    `json:"username"`
 	Password     string    `json:"password,omitempty"`
 	PasswordHash string    `json:"password_hash,omitempty"`
+	IsAdmin      bool      `json:"is_admin"`
+	IsDisabled   bool      `json:"is_disabled"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }